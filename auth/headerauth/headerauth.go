@@ -0,0 +1,152 @@
+// Package headerauth provides a shortlinks.Auth driver that trusts identity headers set by a reverse proxy.
+package headerauth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+const (
+	DefaultUserHeader   = "X-Forwarded-User"
+	DefaultEmailHeader  = "X-Forwarded-Email"
+	DefaultGroupsHeader = "X-Forwarded-Groups"
+)
+
+var (
+	ErrUntrustedProxy = errors.New("headerauth: request did not come from a trusted proxy")
+	ErrNoUser         = errors.New("headerauth: no user header")
+)
+
+type Auther struct {
+	// UserHeader, EmailHeader, and GroupsHeader name the headers set by
+	// the proxy; they default to X-Forwarded-User, X-Forwarded-Email, and
+	// X-Forwarded-Groups.  Groups are comma separated.
+	UserHeader, EmailHeader, GroupsHeader string
+
+	// TrustedProxies are the networks that requests with the above headers
+	// must come from.
+	TrustedProxies []netip.Prefix
+
+	// AllowedGroups, if set, requires that users be in at least one of
+	// these groups.
+	AllowedGroups []string
+}
+
+// ParsePrefixes parses a comma separated list of CIDRs or bare addresses.
+func ParsePrefixes(s string) ([]netip.Prefix, error) {
+	var ret []netip.Prefix
+	for _, p := range strings.Split(s, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if !strings.Contains(p, "/") {
+			a, err := netip.ParseAddr(p)
+			if err != nil {
+				return nil, fmt.Errorf("couldn't parse trusted proxy (%s): %w", p, err)
+			}
+			ret = append(ret, netip.PrefixFrom(a, a.BitLen()))
+			continue
+		}
+		pfx, err := netip.ParsePrefix(p)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't parse trusted proxy (%s): %w", p, err)
+		}
+		ret = append(ret, pfx.Masked())
+	}
+	return ret, nil
+}
+
+func (a Auther) header(h, def string) string {
+	if h == "" {
+		return def
+	}
+	return h
+}
+
+// Wrap removes the identity headers from requests that didn't come from a
+// trusted proxy, so that nothing downstream can be fooled by them.
+func (a Auther) Wrap(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.trusted(r) {
+			r.Header.Del(a.header(a.UserHeader, DefaultUserHeader))
+			r.Header.Del(a.header(a.EmailHeader, DefaultEmailHeader))
+			r.Header.Del(a.header(a.GroupsHeader, DefaultGroupsHeader))
+		}
+		inner.ServeHTTP(w, r)
+	})
+}
+
+func (a Auther) Name() string { return "header" }
+
+// User returns the user header, falling back to the email header.
+func (a Auther) User(r *http.Request) (string, error) {
+	if !a.trusted(r) {
+		return "", ErrUntrustedProxy
+	}
+
+	u := r.Header.Get(a.header(a.UserHeader, DefaultUserHeader))
+	if u == "" {
+		u = r.Header.Get(a.header(a.EmailHeader, DefaultEmailHeader))
+	}
+	if u == "" {
+		return "", ErrNoUser
+	}
+
+	if len(a.AllowedGroups) != 0 {
+		gs, err := a.Groups(r)
+		if err != nil {
+			return "", err
+		}
+		if !intersects(gs, a.AllowedGroups) {
+			return "", fmt.Errorf("headerauth: %s is not in an allowed group", u)
+		}
+	}
+
+	return u, nil
+}
+
+// Groups returns the groups the proxy says the user is in.
+func (a Auther) Groups(r *http.Request) ([]string, error) {
+	if !a.trusted(r) {
+		return nil, ErrUntrustedProxy
+	}
+
+	var ret []string
+	for _, v := range r.Header.Values(a.header(a.GroupsHeader, DefaultGroupsHeader)) {
+		for _, g := range strings.Split(v, ",") {
+			if g = strings.TrimSpace(g); g != "" {
+				ret = append(ret, g)
+			}
+		}
+	}
+	return ret, nil
+}
+
+func (a Auther) trusted(r *http.Request) bool {
+	ap, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	addr := ap.Addr().Unmap()
+	for _, p := range a.TrustedProxies {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func intersects(a, b []string) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package headerauth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestUser(t *testing.T) {
+	proxies, err := ParsePrefixes("10.0.0.0/8, ::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := Auther{TrustedProxies: proxies}
+
+	cases := []struct {
+		name, remote string
+		headers      map[string]string
+		allowed      []string
+		user         string
+		err          bool
+	}{
+		{name: "trusted", remote: "10.1.2.3:1234", headers: map[string]string{"X-Forwarded-User": "frew"}, user: "frew"},
+		{name: "trusted v6", remote: "[::1]:1234", headers: map[string]string{"X-Forwarded-User": "frew"}, user: "frew"},
+		{name: "mapped v4", remote: "[::ffff:10.1.2.3]:1234", headers: map[string]string{"X-Forwarded-User": "frew"}, user: "frew"},
+		{name: "email fallback", remote: "10.1.2.3:1234", headers: map[string]string{"X-Forwarded-Email": "frew@example.com"}, user: "frew@example.com"},
+		{name: "untrusted", remote: "192.168.1.1:1234", headers: map[string]string{"X-Forwarded-User": "frew"}, err: true},
+		{name: "missing", remote: "10.1.2.3:1234", err: true},
+		{name: "allowed group", remote: "10.1.2.3:1234", headers: map[string]string{"X-Forwarded-User": "frew", "X-Forwarded-Groups": "eng, ops"}, allowed: []string{"ops"}, user: "frew"},
+		{name: "disallowed group", remote: "10.1.2.3:1234", headers: map[string]string{"X-Forwarded-User": "frew", "X-Forwarded-Groups": "eng"}, allowed: []string{"ops"}, err: true},
+	}
+
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = c.remote
+		for k, v := range c.headers {
+			r.Header.Set(k, v)
+		}
+		a.AllowedGroups = c.allowed
+
+		u, err := a.User(r)
+		if c.err {
+			if err == nil {
+				t.Errorf("%s: expected error, got user %q", c.name, u)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", c.name, err)
+			continue
+		}
+		if u != c.user {
+			t.Errorf("%s: expected %q, got %q", c.name, c.user, u)
+		}
+	}
+}
+
+func TestWrapStripsUntrusted(t *testing.T) {
+	a := Auther{UserHeader: "X-User"}
+
+	var got string
+	h := a.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("X-User")
+	}))
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-User", "frew")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	if got != "" {
+		t.Errorf("expected header to be stripped, got %q", got)
+	}
+}
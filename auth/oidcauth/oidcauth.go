@@ -0,0 +1,350 @@
+// Package oidcauth provides a shortlinks.Auth driver that logs users in with OpenID Connect.
+package oidcauth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+
+	"github.com/frioux/shortlinks/shortlinks"
+)
+
+const (
+	LoginPath    = "/_login"
+	CallbackPath = "/_oidc/callback"
+	LogoutPath   = "/_logout"
+
+	sessionCookie = "shortlinks_session"
+	stateCookie   = "shortlinks_oidc_state"
+)
+
+// ErrNoSession is returned by User when the request has no valid session.
+var ErrNoSession = errors.New("oidcauth: not logged in")
+
+type Config struct {
+	// Issuer is the URL of the OpenID Connect provider, used for discovery.
+	Issuer string
+
+	ClientID, ClientSecret string
+
+	// RedirectURL is the absolute URL of the callback route, for example
+	// https://go.example.com/_oidc/callback.
+	RedirectURL string
+
+	// AllowedDomains limits logins to users whose email address is at one
+	// of these domains.  If empty any verified email is allowed.
+	AllowedDomains []string
+
+	// SessionKey is used to sign session cookies.  If empty a random key is
+	// generated, which means sessions do not survive restarts.
+	SessionKey []byte
+
+	// SessionTTL is how long a session lasts; defaults to a week.
+	SessionTTL time.Duration
+}
+
+type Auther struct {
+	oauth    oauth2.Config
+	verifier *oidc.IDTokenVerifier
+
+	allowed []string
+	key     []byte
+	ttl     time.Duration
+	secure  bool
+}
+
+// New discovers the provider configuration from c.Issuer and returns an
+// Auther ready to use.
+func New(ctx context.Context, c Config) (*Auther, error) {
+	p, err := oidc.NewProvider(ctx, c.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("oidc.NewProvider: %w", err)
+	}
+
+	key := c.SessionKey
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+	}
+
+	ttl := c.SessionTTL
+	if ttl == 0 {
+		ttl = 7 * 24 * time.Hour
+	}
+
+	allowed := make([]string, 0, len(c.AllowedDomains))
+	for _, d := range c.AllowedDomains {
+		allowed = append(allowed, strings.ToLower(d))
+	}
+
+	return &Auther{
+		oauth: oauth2.Config{
+			ClientID:     c.ClientID,
+			ClientSecret: c.ClientSecret,
+			RedirectURL:  c.RedirectURL,
+			Endpoint:     p.Endpoint(),
+			Scopes:       []string{oidc.ScopeOpenID, "email", "profile"},
+		},
+		verifier: p.Verifier(&oidc.Config{ClientID: c.ClientID}),
+
+		allowed: allowed,
+		key:     key,
+		ttl:     ttl,
+		secure:  strings.HasPrefix(c.RedirectURL, "https:"),
+	}, nil
+}
+
+func (a *Auther) Wrap(inner http.Handler) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/", inner)
+	mux.HandleFunc(LoginPath, a.login)
+	mux.HandleFunc(CallbackPath, a.callback)
+	mux.HandleFunc(LogoutPath, a.logout)
+	return mux
+}
+
+func (a *Auther) Name() string { return "oidc" }
+
+func (a *Auther) User(r *http.Request) (string, error) {
+	c, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return "", ErrNoSession
+	}
+
+	var s session
+	if err := a.open(c.Value, &s); err != nil {
+		return "", ErrNoSession
+	}
+	if time.Now().After(time.Unix(s.Expires, 0)) {
+		return "", ErrNoSession
+	}
+
+	return s.Email, nil
+}
+
+// LoginURL returns the path to send r to for logging in, returning to the
+// current page afterwards.
+func (a *Auther) LoginURL(r *http.Request) string {
+	return LoginPath + "?next=" + url.QueryEscape(r.URL.RequestURI())
+}
+
+type session struct {
+	Email   string `json:"e"`
+	Expires int64  `json:"x"`
+}
+
+type state struct {
+	State string `json:"s"`
+	Nonce string `json:"n"`
+	Next  string `json:"r"`
+}
+
+func (a *Auther) login(w http.ResponseWriter, r *http.Request) {
+	st := state{State: randomString(), Nonce: randomString(), Next: safeNext(r.URL.Query().Get("next"))}
+	v, err := a.seal(st)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	// Lax rather than Strict because the provider redirects back to us
+	// from another site.
+	http.SetCookie(w, &http.Cookie{
+		Name:     stateCookie,
+		Value:    v,
+		Path:     CallbackPath,
+		MaxAge:   600,
+		HttpOnly: true,
+		Secure:   a.secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, a.oauth.AuthCodeURL(st.State, oidc.Nonce(st.Nonce)), 302)
+}
+
+func (a *Auther) callback(w http.ResponseWriter, r *http.Request) {
+	c, err := r.Cookie(stateCookie)
+	if err != nil {
+		http.Error(w, "missing login state", 400)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: stateCookie, Path: CallbackPath, MaxAge: -1})
+
+	var st state
+	if err := a.open(c.Value, &st); err != nil || st.State != r.URL.Query().Get("state") {
+		http.Error(w, "invalid login state", 400)
+		return
+	}
+
+	if e := r.URL.Query().Get("error"); e != "" {
+		http.Error(w, "login failed: "+e, 403)
+		return
+	}
+
+	email, err := a.exchange(r.Context(), r.URL.Query().Get("code"), st.Nonce)
+	if err != nil {
+		http.Error(w, err.Error(), 403)
+		return
+	}
+
+	v, err := a.seal(session{Email: email, Expires: time.Now().Add(a.ttl).Unix()})
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    v,
+		Path:     "/",
+		MaxAge:   int(a.ttl / time.Second),
+		HttpOnly: true,
+		Secure:   a.secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, st.Next, 302)
+}
+
+// exchange trades code for tokens and returns the email address from the
+// verified ID token.
+func (a *Auther) exchange(ctx context.Context, code, nonce string) (string, error) {
+	tok, err := a.oauth.Exchange(ctx, code)
+	if err != nil {
+		return "", fmt.Errorf("couldn't exchange code: %w", err)
+	}
+
+	raw, ok := tok.Extra("id_token").(string)
+	if !ok {
+		return "", errors.New("no id_token in token response")
+	}
+
+	idt, err := a.verifier.Verify(ctx, raw)
+	if err != nil {
+		return "", fmt.Errorf("couldn't verify id_token: %w", err)
+	}
+	if idt.Nonce != nonce {
+		return "", errors.New("id_token nonce mismatch")
+	}
+
+	var claims struct {
+		Email         string `json:"email"`
+		EmailVerified *bool  `json:"email_verified"`
+	}
+	if err := idt.Claims(&claims); err != nil {
+		return "", fmt.Errorf("couldn't parse claims: %w", err)
+	}
+	if claims.Email == "" {
+		return "", errors.New("id_token has no email")
+	}
+	if claims.EmailVerified != nil && !*claims.EmailVerified {
+		return "", fmt.Errorf("email %s is not verified", claims.Email)
+	}
+	if !a.allowedEmail(claims.Email) {
+		return "", fmt.Errorf("email %s is not allowed", claims.Email)
+	}
+
+	return claims.Email, nil
+}
+
+var logoutForm = template.Must(template.New("logout").Parse(`<!DOCTYPE html>
+<title>log out</title>
+<form action="` + LogoutPath + `" method="post">
+    <input type="hidden" name="csrf" value="{{.}}">
+    <input type="submit" value="Log out">
+</form>
+`))
+
+func (a *Auther) logout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		token := shortlinks.IssueCSRFToken(w, r)
+		w.Header().Add("Content-Type", "text/html; charset=utf-8")
+		if err := logoutForm.Execute(w, token); err != nil {
+			http.Error(w, err.Error(), 500)
+		}
+		return
+	}
+	if err := shortlinks.CheckCSRF(r); err != nil {
+		http.Error(w, err.Error(), 403)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Path: "/", MaxAge: -1})
+	http.Redirect(w, r, "/", 303)
+}
+
+func (a *Auther) allowedEmail(email string) bool {
+	if len(a.allowed) == 0 {
+		return true
+	}
+
+	i := strings.LastIndex(email, "@")
+	if i == -1 {
+		return false
+	}
+	domain := strings.ToLower(email[i+1:])
+	for _, d := range a.allowed {
+		if domain == d {
+			return true
+		}
+	}
+	return false
+}
+
+// seal serializes v and signs it so that it can be stored in a cookie.
+func (a *Auther) seal(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(b)
+	return payload + "." + a.sign(payload), nil
+}
+
+// open verifies a value created by seal and deserializes it into v.
+func (a *Auther) open(s string, v interface{}) error {
+	payload, sig, ok := strings.Cut(s, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(a.sign(payload))) {
+		return errors.New("invalid signature")
+	}
+	b, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func (a *Auther) sign(payload string) string {
+	m := hmac.New(sha256.New, a.key)
+	m.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(m.Sum(nil))
+}
+
+func randomString() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// safeNext only allows local paths, so that ?next= can't be used to send
+// users elsewhere after logging in.
+func safeNext(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
@@ -0,0 +1,282 @@
+package oidcauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+)
+
+// mockProvider is a minimal OpenID Connect provider that logs everyone in as
+// email.
+type mockProvider struct {
+	*httptest.Server
+
+	key   *rsa.PrivateKey
+	email string
+
+	// code -> nonce
+	codes map[string]string
+}
+
+func newMockProvider(t *testing.T, email string) *mockProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &mockProvider{key: key, email: email, codes: map[string]string{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("/jwks", p.jwks)
+	mux.HandleFunc("/authorize", p.authorize)
+	mux.HandleFunc("/token", p.token)
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+
+	return p
+}
+
+func (p *mockProvider) discovery(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"issuer":                                p.URL,
+		"authorization_endpoint":                p.URL + "/authorize",
+		"token_endpoint":                        p.URL + "/token",
+		"jwks_uri":                              p.URL + "/jwks",
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	})
+}
+
+func (p *mockProvider) jwks(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"alg": "RS256",
+			"use": "sig",
+			"kid": "test",
+			"n":   base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.E)).Bytes()),
+		}},
+	})
+}
+
+func (p *mockProvider) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	code := fmt.Sprintf("code%d", len(p.codes))
+	p.codes[code] = q.Get("nonce")
+
+	u, _ := url.Parse(q.Get("redirect_uri"))
+	u.RawQuery = url.Values{"code": {code}, "state": {q.Get("state")}}.Encode()
+	http.Redirect(w, r, u.String(), 302)
+}
+
+func (p *mockProvider) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	nonce, ok := p.codes[r.Form.Get("code")]
+	if !ok {
+		http.Error(w, "bad code", 400)
+		return
+	}
+
+	idt := p.sign(map[string]interface{}{
+		"iss":            p.URL,
+		"sub":            "1234",
+		"aud":            "client",
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"iat":            time.Now().Unix(),
+		"nonce":          nonce,
+		"email":          p.email,
+		"email_verified": true,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idt,
+	})
+}
+
+func (p *mockProvider) sign(claims map[string]interface{}) string {
+	h, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": "test"})
+	c, _ := json.Marshal(claims)
+	payload := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+
+	sum := sha256.Sum256([]byte(payload))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, sum[:])
+	if err != nil {
+		panic(err)
+	}
+	return payload + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// login runs through the whole flow against a server protected by an Auther
+// and returns what the server saw as the user, along with the logged in
+// client and the server's URL.
+func login(t *testing.T, email string, allowed []string) (int, string, *http.Client, string) {
+	p := newMockProvider(t, email)
+
+	// The app's URL is needed to configure the Auther, so start it before
+	// setting the handler.
+	app := httptest.NewServer(nil)
+	t.Cleanup(app.Close)
+
+	a, err := New(context.Background(), Config{
+		Issuer:         p.URL,
+		ClientID:       "client",
+		ClientSecret:   "secret",
+		RedirectURL:    app.URL + CallbackPath,
+		AllowedDomains: allowed,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.Config.Handler = a.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, err := a.User(r)
+		if err != nil {
+			http.Error(w, err.Error(), 403)
+			return
+		}
+		fmt.Fprintf(w, "%s %s", r.URL.Path, u)
+	}))
+
+	jar, _ := cookiejar.New(nil)
+	cl := &http.Client{Jar: jar}
+
+	resp, err := cl.Get(app.URL + "/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 403 {
+		t.Errorf("expected 403 before logging in, got %d", resp.StatusCode)
+	}
+
+	resp, err = cl.Get(app.URL + LoginPath + "?next=/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+
+	return resp.StatusCode, string(b), cl, app.URL
+}
+
+func TestLogin(t *testing.T) {
+	code, body, _, _ := login(t, "frew@example.com", []string{"Example.com"})
+	if code != 200 {
+		t.Fatalf("expected 200, got %d: %s", code, body)
+	}
+	if body != "/foo frew@example.com" {
+		t.Errorf("unexpected body: %q", body)
+	}
+}
+
+func TestLoginDisallowedDomain(t *testing.T) {
+	code, body, _, _ := login(t, "frew@evil.com", []string{"example.com"})
+	if code != 403 {
+		t.Fatalf("expected 403, got %d: %s", code, body)
+	}
+}
+
+func TestLogout(t *testing.T) {
+	code, body, cl, base := login(t, "frew@example.com", nil)
+	if code != 200 {
+		t.Fatalf("expected to log in, got %d: %s", code, body)
+	}
+	cl.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+
+	loggedIn := func() bool {
+		resp, err := cl.Get(base + "/foo")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode == 200
+	}
+
+	// A GET, which any site can trigger, only offers a form.
+	resp, err := cl.Get(base + LogoutPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	m := regexp.MustCompile(`name="csrf" value="([^"]+)"`).FindStringSubmatch(string(b))
+	if resp.StatusCode != 200 || m == nil {
+		t.Fatalf("expected a logout form, got %d: %s", resp.StatusCode, b)
+	}
+	if !loggedIn() {
+		t.Fatal("expected GET to leave the session alone")
+	}
+
+	resp, err = cl.PostForm(base+LogoutPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 403 || !loggedIn() {
+		t.Fatalf("expected a post without a csrf token to be refused, got %d", resp.StatusCode)
+	}
+
+	resp, err = cl.PostForm(base+LogoutPath, url.Values{"csrf": {m[1]}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 303 || loggedIn() {
+		t.Errorf("expected to be logged out, got %d", resp.StatusCode)
+	}
+}
+
+func TestSafeNext(t *testing.T) {
+	for in, out := range map[string]string{
+		"":                   "/",
+		"/_edit/?from=x":     "/_edit/?from=x",
+		"//evil.com":         "/",
+		"/\\evil.com":        "/",
+		"https://evil.com/":  "/",
+		"javascript:alert()": "/",
+	} {
+		if got := safeNext(in); got != out {
+			t.Errorf("safeNext(%q) = %q, expected %q", in, got, out)
+		}
+	}
+}
+
+func TestSessionTamper(t *testing.T) {
+	a := &Auther{key: []byte("key")}
+	v, err := a.seal(session{Email: "a@b.c", Expires: time.Now().Add(time.Hour).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(&http.Cookie{Name: sessionCookie, Value: v})
+	if u, err := a.User(r); err != nil || u != "a@b.c" {
+		t.Errorf("expected a@b.c, got %q (%v)", u, err)
+	}
+
+	r = httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(&http.Cookie{Name: sessionCookie, Value: "x" + v})
+	if _, err := a.User(r); err != ErrNoSession {
+		t.Errorf("expected ErrNoSession for tampered cookie, got %v", err)
+	}
+}
@@ -1,22 +1,127 @@
+// Package tailscaleauth provides a shortlinks.Auth driver that identifies users with tailscaled.
 package tailscaleauth
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"sort"
+	"strings"
 
-	"tailscale.com/client/tailscale"
+	"tailscale.com/client/tailscale/apitype"
 )
 
-type Auther struct{}
+// WhoIser looks up who is on the other end of a connection.
+// *tailscale.LocalClient implements it, and tests can provide a fake.
+type WhoIser interface {
+	WhoIs(ctx context.Context, remoteAddr string) (*apitype.WhoIsResponse, error)
+}
+
+type Auther struct {
+	// Source is used to identify peers.  Use &tailscale.LocalClient{} to
+	// ask the local tailscaled, or tsnet.Server.LocalClient when embedding
+	// tailscale.
+	Source WhoIser
+
+	// Capability, if set, is the peer capability required to make
+	// changes (anything other than GET or HEAD).
+	Capability string
+}
+
+// Identity is what tailscale knows about a peer.
+type Identity struct {
+	// LoginName is the unique name of the user, eg alice@example.com.
+	// For tagged nodes it's the placeholder "tagged-devices".
+	LoginName string
+
+	// DisplayName is the user's name, eg Alice Smith.
+	DisplayName string
+
+	// NodeName is the MagicDNS name of the peer, eg
+	// laptop.tailnet.ts.net.
+	NodeName string
+
+	// Tags are the ACL tags of the peer, if any.
+	Tags []string
+
+	// Caps are the capabilities granted to the peer by the tailnet
+	// policy.
+	Caps []string
+}
+
+// Tagged returns true if the peer is a tagged node rather than a user's.
+func (i Identity) Tagged() bool { return len(i.Tags) != 0 }
+
+// HasCap returns true if the peer was granted capability c.
+func (i Identity) HasCap(c string) bool {
+	for _, ic := range i.Caps {
+		if ic == c {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the name recorded for the peer in history.
+func (i Identity) String() string {
+	if i.Tagged() {
+		return i.NodeName
+	}
+	return i.LoginName
+}
 
 func (a Auther) Wrap(inner http.Handler) http.Handler {
 	return inner
 }
 
+func (a Auther) Name() string { return "tailscale" }
+
 func (a Auther) User(r *http.Request) (string, error) {
-	u, err := tailscale.WhoIs(r.Context(), r.RemoteAddr)
+	id, err := a.Identity(r)
 	if err != nil {
 		return "", err
 	}
 
-	return u.UserProfile.DisplayName, nil
+	if a.Capability != "" && r.Method != "GET" && r.Method != "HEAD" && !id.HasCap(a.Capability) {
+		return "", fmt.Errorf("tailscaleauth: %s lacks capability %s", id, a.Capability)
+	}
+
+	return id.String(), nil
+}
+
+// Identity looks up the peer that made r.
+func (a Auther) Identity(r *http.Request) (Identity, error) {
+	if a.Source == nil {
+		return Identity{}, errors.New("tailscaleauth: no Source configured")
+	}
+
+	w, err := a.Source.WhoIs(r.Context(), r.RemoteAddr)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	var id Identity
+	if w.UserProfile != nil {
+		id.LoginName = w.UserProfile.LoginName
+		id.DisplayName = w.UserProfile.DisplayName
+	}
+	if w.Node != nil {
+		id.NodeName = w.Node.ComputedName
+		if id.NodeName == "" {
+			// Name is the FQDN, which ends in a dot.
+			id.NodeName = strings.TrimSuffix(w.Node.Name, ".")
+		}
+		id.Tags = w.Node.Tags
+	}
+	for c := range w.CapMap {
+		id.Caps = append(id.Caps, string(c))
+	}
+	sort.Strings(id.Caps)
+
+	if id.String() == "" {
+		return Identity{}, fmt.Errorf("tailscaleauth: no identity for %s", r.RemoteAddr)
+	}
+
+	return id, nil
 }
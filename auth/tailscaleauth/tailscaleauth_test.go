@@ -0,0 +1,114 @@
+package tailscaleauth
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"tailscale.com/client/tailscale/apitype"
+	"tailscale.com/tailcfg"
+)
+
+type fakeSource map[string]*apitype.WhoIsResponse
+
+func (f fakeSource) WhoIs(_ context.Context, remoteAddr string) (*apitype.WhoIsResponse, error) {
+	w, ok := f[remoteAddr]
+	if !ok {
+		return nil, errors.New("no such peer")
+	}
+	return w, nil
+}
+
+const editCap = "example.com/cap/shortlinks-edit"
+
+func TestUser(t *testing.T) {
+	src := fakeSource{
+		"100.64.0.1:1234": {
+			Node:        &tailcfg.Node{Name: "laptop.tailnet.ts.net."},
+			UserProfile: &tailcfg.UserProfile{LoginName: "alice@example.com", DisplayName: "Alice"},
+			CapMap:      tailcfg.PeerCapMap{editCap: nil},
+		},
+		"100.64.0.2:1234": {
+			Node:        &tailcfg.Node{Name: "phone.tailnet.ts.net.", ComputedName: "phone"},
+			UserProfile: &tailcfg.UserProfile{LoginName: "bob@example.com", DisplayName: "Alice"},
+		},
+		"100.64.0.3:1234": {
+			Node:        &tailcfg.Node{Name: "ci.tailnet.ts.net.", ComputedName: "ci", Tags: []string{"tag:ci"}},
+			UserProfile: &tailcfg.UserProfile{LoginName: "tagged-devices", DisplayName: "Tagged Devices"},
+			CapMap:      tailcfg.PeerCapMap{editCap: nil},
+		},
+	}
+
+	cases := []struct {
+		name, remote, method, capability, user string
+		err                                    bool
+	}{
+		{name: "login name", remote: "100.64.0.1:1234", method: "POST", user: "alice@example.com"},
+		{name: "no cap required", remote: "100.64.0.2:1234", method: "POST", user: "bob@example.com"},
+		{name: "tagged", remote: "100.64.0.3:1234", method: "POST", user: "ci"},
+		{name: "has cap", remote: "100.64.0.1:1234", method: "POST", capability: editCap, user: "alice@example.com"},
+		{name: "lacks cap", remote: "100.64.0.2:1234", method: "POST", capability: editCap, err: true},
+		{name: "lacks cap reading", remote: "100.64.0.2:1234", method: "GET", capability: editCap, user: "bob@example.com"},
+		{name: "unknown", remote: "100.64.0.9:1234", method: "GET", err: true},
+	}
+
+	for _, c := range cases {
+		a := Auther{Source: src, Capability: c.capability}
+		r := httptest.NewRequest(c.method, "/_edit/", nil)
+		r.RemoteAddr = c.remote
+
+		u, err := a.User(r)
+		if c.err {
+			if err == nil {
+				t.Errorf("%s: expected error, got %q", c.name, u)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", c.name, err)
+			continue
+		}
+		if u != c.user {
+			t.Errorf("%s: expected %q, got %q", c.name, c.user, u)
+		}
+	}
+}
+
+func TestIdentity(t *testing.T) {
+	a := Auther{Source: fakeSource{
+		"100.64.0.3:1234": {
+			Node:        &tailcfg.Node{Name: "ci.tailnet.ts.net.", ComputedName: "ci", Tags: []string{"tag:ci"}},
+			UserProfile: &tailcfg.UserProfile{LoginName: "tagged-devices", DisplayName: "Tagged Devices"},
+		},
+	}}
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "100.64.0.3:1234"
+
+	id, err := a.Identity(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !id.Tagged() || id.NodeName != "ci" || id.LoginName != "tagged-devices" || id.DisplayName != "Tagged Devices" {
+		t.Errorf("unexpected identity: %+v", id)
+	}
+}
+
+func TestIdentityNodeName(t *testing.T) {
+	a := Auther{Source: fakeSource{
+		"100.64.0.1:1234": {
+			Node:        &tailcfg.Node{Name: "laptop.tailnet.ts.net."},
+			UserProfile: &tailcfg.UserProfile{LoginName: "alice@example.com"},
+		},
+	}}
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "100.64.0.1:1234"
+
+	id, err := a.Identity(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.NodeName != "laptop.tailnet.ts.net" {
+		t.Errorf("expected trailing dot trimmed, got %q", id.NodeName)
+	}
+}
@@ -0,0 +1,118 @@
+// Package tokenauth provides a shortlinks.Auth driver that accepts API tokens as bearer tokens.
+package tokenauth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/frioux/shortlinks/shortlinks"
+)
+
+var (
+	ErrNoToken      = errors.New("tokenauth: no bearer token")
+	ErrInvalidToken = errors.New("tokenauth: invalid or expired token")
+)
+
+type Auther struct {
+	DB shortlinks.DBTokens
+}
+
+func (a Auther) Wrap(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secret, ok := bearer(r)
+		if !ok {
+			inner.ServeHTTP(w, r)
+			return
+		}
+
+		t, err := a.token(secret)
+		if errors.Is(err, ErrInvalidToken) {
+			w.Header().Add("Content-Type", "text/plain")
+			w.Header().Add("WWW-Authenticate", `Bearer error="invalid_token"`)
+			w.WriteHeader(401)
+			fmt.Fprintln(w, err)
+			return
+		}
+		if err != nil {
+			// Storage errors may say more than a client should see.
+			fmt.Fprintln(os.Stderr, "tokenauth:", err)
+			w.Header().Add("Content-Type", "text/plain")
+			w.WriteHeader(500)
+			fmt.Fprintln(w, "tokenauth: couldn't check token")
+			return
+		}
+
+		if scope := requiredScope(r); !t.HasScope(scope) {
+			w.Header().Add("Content-Type", "text/plain")
+			w.Header().Add("WWW-Authenticate", `Bearer error="insufficient_scope", scope="`+scope+`"`)
+			w.WriteHeader(403)
+			fmt.Fprintf(w, "token lacks %s scope\n", scope)
+			return
+		}
+
+		inner.ServeHTTP(w, r.WithContext(shortlinks.WithToken(r.Context(), t)))
+	})
+}
+
+func (a Auther) User(r *http.Request) (string, error) {
+	if t, ok := shortlinks.TokenFrom(r.Context()); ok {
+		return Who(t), nil
+	}
+
+	if _, ok := bearer(r); ok {
+		// Only reachable if Wrap wasn't used.
+		return "", ErrInvalidToken
+	}
+
+	return "", ErrNoToken
+}
+
+func (a Auther) Name() string { return "token" }
+
+// CSRFExempt returns true for requests authenticated with a token, since
+// browsers never send bearer tokens on their own.
+func (a Auther) CSRFExempt(r *http.Request) bool {
+	_, ok := shortlinks.TokenFrom(r.Context())
+	return ok
+}
+
+// Who is how a token is recorded in history.
+func Who(t shortlinks.Token) string {
+	if t.Owner == "" {
+		return "token " + t.Name
+	}
+	return t.Owner + " (token " + t.Name + ")"
+}
+
+func (a Auther) token(secret string) (shortlinks.Token, error) {
+	t, err := a.DB.TokenByHash(shortlinks.HashToken(secret))
+	if err != nil {
+		return shortlinks.Token{}, err
+	}
+	if t.ID == "" || t.Expired(time.Now()) {
+		return shortlinks.Token{}, ErrInvalidToken
+	}
+	return t, nil
+}
+
+func bearer(r *http.Request) (string, bool) {
+	h := r.Header.Get("Authorization")
+	if len(h) < 7 || !strings.EqualFold(h[:7], "bearer ") {
+		return "", false
+	}
+	return strings.TrimSpace(h[7:]), true
+}
+
+func requiredScope(r *http.Request) string {
+	if strings.HasPrefix(r.URL.Path, "/_tokens/") {
+		return shortlinks.ScopeAdmin
+	}
+	if r.Method == "GET" || r.Method == "HEAD" {
+		return shortlinks.ScopeRead
+	}
+	return shortlinks.ScopeWrite
+}
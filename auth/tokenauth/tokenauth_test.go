@@ -0,0 +1,110 @@
+package tokenauth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/frioux/shortlinks/shortlinks"
+)
+
+type fakeDB map[string]shortlinks.Token
+
+func (db fakeDB) CreateToken(t shortlinks.Token) error           { db[t.Hash] = t; return nil }
+func (db fakeDB) TokenByHash(h string) (shortlinks.Token, error) { return db[h], nil }
+func (db fakeDB) Tokens() ([]shortlinks.Token, error)            { return nil, nil }
+func (db fakeDB) RevokeToken(string) error                       { return nil }
+
+type fakeAuth struct{}
+
+func (fakeAuth) Wrap(h http.Handler) http.Handler { return h }
+func (fakeAuth) User(r *http.Request) (string, error) {
+	if u := r.Header.Get("X-Test-User"); u != "" {
+		return u, nil
+	}
+	return "", errors.New("no user")
+}
+
+func TestAuther(t *testing.T) {
+	db := fakeDB{}
+	read, _ := mint(db, "ci", shortlinks.ScopeRead, 0)
+	write, _ := mint(db, "ci", shortlinks.ScopeWrite, 0)
+	admin, _ := mint(db, "ci", shortlinks.ScopeAdmin, 0)
+	expired, _ := mint(db, "ci", shortlinks.ScopeAdmin, -time.Hour)
+
+	a := shortlinks.Chain{Auther{DB: db}, fakeAuth{}}
+	h := a.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, err := a.User(r)
+		if err != nil {
+			http.Error(w, err.Error(), 403)
+			return
+		}
+		fmt.Fprint(w, u)
+	}))
+
+	cases := []struct {
+		name, method, path, auth, user string
+		code                           int
+		body                           string
+	}{
+		{name: "read get", method: "GET", path: "/", auth: read, code: 200, body: "frew (token ci)"},
+		{name: "read post", method: "POST", path: "/_edit/", auth: read, code: 403},
+		{name: "write post", method: "POST", path: "/_edit/", auth: write, code: 200, body: "frew (token ci)"},
+		{name: "write tokens", method: "GET", path: "/_tokens/", auth: write, code: 403},
+		{name: "admin tokens", method: "POST", path: "/_tokens/", auth: admin, code: 200},
+		{name: "expired", method: "GET", path: "/", auth: expired, code: 401},
+		{name: "bogus", method: "GET", path: "/", auth: "sl_nope", code: 401},
+		{name: "fallback", method: "POST", path: "/_edit/", user: "alice", code: 200, body: "alice"},
+		{name: "fallback fails", method: "POST", path: "/_edit/", code: 403},
+	}
+
+	for _, c := range cases {
+		r := httptest.NewRequest(c.method, c.path, nil)
+		if c.auth != "" {
+			r.Header.Set("Authorization", "Bearer "+c.auth)
+		}
+		if c.user != "" {
+			r.Header.Set("X-Test-User", c.user)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		if w.Code != c.code {
+			t.Errorf("%s: expected %d, got %d (%s)", c.name, c.code, w.Code, w.Body)
+			continue
+		}
+		if c.body != "" && w.Body.String() != c.body {
+			t.Errorf("%s: expected body %q, got %q", c.name, c.body, w.Body)
+		}
+	}
+}
+
+func mint(db fakeDB, name, scope string, ttl time.Duration) (string, shortlinks.Token) {
+	secret, t := shortlinks.NewToken(name, "frew", []string{scope}, ttl)
+	db.CreateToken(t)
+	return secret, t
+}
+
+// brokenDB fails every lookup with an error that mustn't reach clients.
+type brokenDB struct{ fakeDB }
+
+func (brokenDB) TokenByHash(string) (shortlinks.Token, error) {
+	return shortlinks.Token{}, errors.New("dial tcp 10.0.0.5:5432: connection refused")
+}
+
+func TestStorageError(t *testing.T) {
+	h := Auther{DB: brokenDB{}}.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer sl_whatever")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if w.Code != 500 || strings.Contains(w.Body.String(), "10.0.0.5") {
+		t.Errorf("expected a generic 500, got %d: %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,242 @@
+// Package declarative syncs shortlinks from a YAML file, usually kept in git.
+package declarative
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/frioux/shortlinks/shortlinks"
+)
+
+// Method is recorded in the history of changes made by a Syncer.
+const Method = "sync"
+
+type Config struct {
+	Links []Link `yaml:"links"`
+}
+
+type Link struct {
+	From        string   `yaml:"from"`
+	To          string   `yaml:"to"`
+	Description string   `yaml:"description,omitempty"`
+	Tags        []string `yaml:"tags,omitempty"`
+}
+
+// Load reads and validates the config at path.
+func Load(path string) (Config, error) {
+	var c Config
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return c, err
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(&c); err != nil && !errors.Is(err, io.EOF) {
+		return c, fmt.Errorf("couldn't parse %s: %w", path, err)
+	}
+
+	seen := map[string]bool{}
+	for i, l := range c.Links {
+		switch {
+		case l.From == "":
+			return c, fmt.Errorf("%s: link %d has no from", path, i+1)
+		case strings.Contains(l.From, "/"):
+			return c, fmt.Errorf("%s: %s can't contain /", path, l.From)
+		case l.To == "":
+			return c, fmt.Errorf("%s: %s has no to", path, l.From)
+		case seen[l.From]:
+			return c, fmt.Errorf("%s: %s is declared more than once", path, l.From)
+		}
+		seen[l.From] = true
+
+		tags, err := shortlinks.NormalizeTags(l.Tags)
+		if err != nil {
+			return c, fmt.Errorf("%s: %s: %w", path, l.From, err)
+		}
+		c.Links[i].Tags = tags
+	}
+
+	return c, nil
+}
+
+func (c Config) dump() shortlinks.Dump {
+	var d shortlinks.Dump
+	for _, l := range c.Links {
+		d.Shortlinks = append(d.Shortlinks, shortlinks.DumpedShortlink{From: l.From, To: l.To, Description: l.Description, Tags: l.Tags})
+	}
+	return d
+}
+
+type Syncer struct {
+	DB shortlinks.DB
+
+	// Path is the YAML file to sync from.
+	Path string
+
+	// Prune deletes shortlinks that were last changed by a Syncer but are
+	// no longer in the file.  Only the first Plan checks the history of
+	// every shortlink; after that only those the file used to declare are
+	// checked.
+	Prune bool
+
+	// Pull runs git pull in the directory of Path before every sync.
+	Pull bool
+
+	// Who is recorded as making changes if the author of the file can't
+	// be found with git.
+	Who string
+
+	// Denied are destinations that links may not point to, as with
+	// shortlinks.Server.DeniedDomains.
+	Denied shortlinks.DomainList
+
+	mu      sync.RWMutex
+	managed map[string]bool
+
+	// synced are the shortlinks this Syncer has managed or found to have
+	// been last changed by a sync, so that pruning only has to check their
+	// history.  It is nil until the first Plan that prunes, which checks
+	// every shortlink.
+	syncedMu sync.Mutex
+	synced   map[string]bool
+}
+
+// Managed returns true if from is declared in the file as of the last Plan.
+func (s *Syncer) Managed(from string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.managed[from]
+}
+
+// Plan works out what Apply would do.
+func (s *Syncer) Plan() ([]shortlinks.ImportChange, error) {
+	c, err := Load(s.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := shortlinks.PlanImport(s.DB, c.dump(), shortlinks.ImportMerge, s.Denied)
+	if err != nil {
+		return nil, err
+	}
+
+	managed := make(map[string]bool, len(c.Links))
+	for _, l := range c.Links {
+		managed[l.From] = true
+	}
+	s.mu.Lock()
+	s.managed = managed
+	s.mu.Unlock()
+
+	if !s.Prune {
+		return changes, nil
+	}
+
+	s.syncedMu.Lock()
+	defer s.syncedMu.Unlock()
+
+	live, err := s.DB.AllShortlinks()
+	if err != nil {
+		return nil, err
+	}
+	synced := make(map[string]bool, len(managed))
+	for from := range managed {
+		synced[from] = true
+	}
+	for _, sl := range live {
+		if managed[sl.From] || (s.synced != nil && !s.synced[sl.From]) {
+			continue
+		}
+		hs, err := s.DB.History(sl.From)
+		if err != nil {
+			return nil, err
+		}
+		if len(hs) != 0 && hs[len(hs)-1].Method == Method {
+			changes = append(changes, shortlinks.ImportChange{Action: shortlinks.ActionDelete, Old: sl})
+			synced[sl.From] = true
+		}
+	}
+	s.synced = synced
+
+	return changes, nil
+}
+
+// Apply syncs the file into the database and returns what changed.
+func (s *Syncer) Apply() ([]shortlinks.ImportChange, error) {
+	if s.Pull {
+		if out, err := s.git("pull", "--ff-only"); err != nil {
+			return nil, fmt.Errorf("git pull: %w: %s", err, out)
+		}
+	}
+
+	changes, err := s.Plan()
+	if err != nil {
+		return nil, err
+	}
+
+	who := s.Author()
+	if who == "" {
+		who = s.Who
+	}
+
+	return changes, shortlinks.ApplyImport(s.DB, changes, who, Method)
+}
+
+// Author returns the author of the last commit to the file, or the empty
+// string if that can't be found.
+func (s *Syncer) Author() string {
+	out, err := s.git("log", "-1", "--format=%an <%ae>", "--", filepath.Base(s.Path))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(out)
+}
+
+func (s *Syncer) git(args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = filepath.Dir(s.Path)
+	out, err := cmd.CombinedOutput()
+	return string(out), err
+}
+
+// Run applies the file every interval until ctx is done, logging changes
+// and errors to stderr.
+func (s *Syncer) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		changes, err := s.Apply()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "couldn't sync %s: %s\n", s.Path, err)
+		}
+		for _, c := range changes {
+			switch c.Action {
+			case shortlinks.ActionCreate, shortlinks.ActionUpdate:
+				fmt.Fprintf(os.Stderr, "sync: %s %s\n", c.Action, c.New.From)
+			case shortlinks.ActionDelete:
+				fmt.Fprintf(os.Stderr, "sync: %s %s\n", c.Action, c.Old.From)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package declarative
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/frioux/shortlinks/shortlinks"
+	"github.com/frioux/shortlinks/storage/memstorage"
+)
+
+func write(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "links.yaml")
+
+	for _, test := range []struct {
+		name, content, err string
+		links              int
+	}{
+		{name: "ok", content: "links:\n  - from: a\n    to: https://a.com\n  - from: b\n    to: https://b.com/%s\n    description: bee\n", links: 2},
+		{name: "empty", content: ""},
+		{name: "no from", content: "links:\n  - to: https://a.com\n", err: "has no from"},
+		{name: "slash", content: "links:\n  - from: a/b\n    to: https://a.com\n", err: "can't contain /"},
+		{name: "no to", content: "links:\n  - from: a\n", err: "has no to"},
+		{name: "duplicate", content: "links:\n  - from: a\n    to: https://a.com\n  - from: a\n    to: https://b.com\n", err: "more than once"},
+		{name: "tags", content: "links:\n  - from: a\n    to: https://a.com\n    tags: [Eng, docs]\n", links: 1},
+		{name: "bad tag", content: "links:\n  - from: a\n    to: https://a.com\n    tags: [a/b]\n", err: "invalid tag"},
+		{name: "unknown field", content: "links:\n  - from: a\n    too: https://a.com\n", err: "couldn't parse"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			write(t, path, test.content)
+			c, err := Load(path)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error containing %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(c.Links) != test.links {
+				t.Errorf("expected %d links, got %d", test.links, len(c.Links))
+			}
+		})
+	}
+}
+
+func TestSyncer(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "links.yaml")
+	db := memstorage.New()
+
+	if err := db.CreateShortlink(shortlinks.Shortlink{From: "handmade", To: "https://handmade.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Syncer{DB: db, Path: path, Prune: true, Who: "robot"}
+
+	write(t, path, "links:\n  - from: a\n    to: https://a.com\n  - from: b\n    to: https://b.com\n")
+	changes, err := s.Apply()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum := shortlinks.ImportSummary(changes); sum[shortlinks.ActionCreate] != 2 || sum[shortlinks.ActionDelete] != 0 {
+		t.Errorf("expected two creates, got %v", sum)
+	}
+	if !s.Managed("a") || s.Managed("handmade") {
+		t.Errorf("expected only declared links to be managed")
+	}
+
+	hs, err := db.History("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hs) != 1 || hs[0].Who != "robot" || hs[0].Method != Method {
+		t.Errorf("expected history by robot via sync, got %+v", hs)
+	}
+
+	write(t, path, "links:\n  - from: a\n    to: https://a.example.com\n")
+	changes, err = s.Apply()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum := shortlinks.ImportSummary(changes); sum[shortlinks.ActionUpdate] != 1 || sum[shortlinks.ActionDelete] != 1 {
+		t.Errorf("expected an update and a delete, got %v", sum)
+	}
+	if sl, _ := db.Shortlink("b"); sl.From != "" {
+		t.Errorf("expected b to be pruned, got %+v", sl)
+	}
+	if sl, _ := db.Shortlink("handmade"); sl.From == "" {
+		t.Errorf("expected handmade link to survive pruning")
+	}
+	if s.Managed("b") {
+		t.Errorf("expected b to no longer be managed")
+	}
+
+	changes, err = s.Plan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum := shortlinks.ImportSummary(changes); sum[shortlinks.ActionUnchanged] != 1 || len(changes) != 1 {
+		t.Errorf("expected nothing to do, got %v", sum)
+	}
+}
+
+func TestSyncerDenied(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "links.yaml")
+	db := memstorage.New()
+	s := &Syncer{DB: db, Path: path, Who: "robot", Denied: shortlinks.ParseDomainList("bit.ly")}
+
+	write(t, path, "links:\n  - from: a\n    to: https://a.com\n  - from: short\n    to: https://bit.ly/x\n")
+	if _, err := s.Apply(); err == nil || !strings.Contains(err.Error(), "short") {
+		t.Errorf("expected syncing a denied destination to fail naming it, got %v", err)
+	}
+	if all, _ := db.AllShortlinks(); len(all) != 0 {
+		t.Errorf("expected nothing to be synced, got %+v", all)
+	}
+}
+
+// historyCounting counts the shortlinks whose history is loaded.
+type historyCounting struct {
+	*memstorage.Client
+	loaded []string
+}
+
+func (db *historyCounting) History(from string) ([]shortlinks.History, error) {
+	db.loaded = append(db.loaded, from)
+	return db.Client.History(from)
+}
+
+func TestPruneHistory(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "links.yaml")
+	db := &historyCounting{Client: memstorage.New()}
+
+	for _, from := range []string{"x", "y", "z"} {
+		if err := db.CreateShortlink(shortlinks.Shortlink{From: from, To: "https://" + from + ".com"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := &Syncer{DB: db, Path: path, Prune: true, Who: "robot"}
+
+	write(t, path, "links:\n  - from: a\n    to: https://a.com\n  - from: b\n    to: https://b.com\n")
+	if _, err := s.Apply(); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(db.loaded, " "); got != "x y z" {
+		t.Errorf("expected the first sync to check every unmanaged link, got %q", got)
+	}
+
+	db.loaded = nil
+	write(t, path, "links:\n  - from: a\n    to: https://a.com\n")
+	changes, err := s.Apply()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum := shortlinks.ImportSummary(changes); sum[shortlinks.ActionDelete] != 1 {
+		t.Errorf("expected b to be pruned, got %v", sum)
+	}
+	if got := strings.Join(db.loaded, " "); got != "b" {
+		t.Errorf("expected only b's history to be checked, got %q", db.loaded)
+	}
+}
+
+func TestAuthor(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "links.yaml")
+	s := &Syncer{Path: path}
+
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=Ada", "GIT_AUTHOR_EMAIL=ada@example.com",
+			"GIT_COMMITTER_NAME=Ada", "GIT_COMMITTER_EMAIL=ada@example.com",
+		)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %s: %s", strings.Join(args, " "), err, out)
+		}
+	}
+
+	write(t, path, "links: []\n")
+	if who := s.Author(); who != "" {
+		t.Errorf("expected no author outside of git, got %q", who)
+	}
+
+	git("init", "-q")
+	git("add", "links.yaml")
+	git("commit", "-q", "-m", "links")
+
+	if who := s.Author(); who != "Ada <ada@example.com>" {
+		t.Errorf("expected Ada <ada@example.com>, got %q", who)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/frioux/shortlinks/shortlinks"
+)
+
+// export writes everything in a database to stdout or a file.
+func export(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s export [-db <db>] [-format json|csv|yaml] [-o file]\n\n", os.Args[0])
+		fs.PrintDefaults()
+		fmt.Fprintf(fs.Output(), "\n%s\n", dbSpecUsage)
+	}
+
+	var spec, format, out string
+	fs.StringVar(&spec, "db", "sqlite:file:db.db", "database to export")
+	fs.StringVar(&format, "format", "", "json, csv or yaml (defaults to guessing from -o, or json)")
+	fs.StringVar(&out, "o", "", "file to write to instead of stdout")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if format == "" {
+		format = shortlinks.DumpFormat(out)
+	}
+
+	db, err := openDB(spec)
+	if err != nil {
+		return err
+	}
+
+	d, err := shortlinks.Export(db)
+	if err != nil {
+		return err
+	}
+
+	if out == "" {
+		return shortlinks.WriteDump(os.Stdout, d, format)
+	}
+
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	if err := shortlinks.WriteDump(f, d, format); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// importCmd loads a dump into a database; see shortlinks.PlanImport.
+func importCmd(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s import [-db <db>] [-format <format>] [-mode merge|replace|skip-existing] [-deny-domains <domains>] [-dry-run] file\n\n", os.Args[0])
+		fs.PrintDefaults()
+		fmt.Fprintf(fs.Output(), "\n%s\n", dbSpecUsage)
+	}
+
+	var spec, format, mode, who, denyDomains string
+	var dryRun bool
+	fs.StringVar(&spec, "db", "sqlite:file:db.db", "database to import into")
+	fs.StringVar(&format, "format", "", strings.Join(shortlinks.ImportFormats, ", ")+" (defaults to guessing from the filename)")
+	fs.StringVar(&mode, "mode", "merge", "merge, replace or skip-existing")
+	fs.StringVar(&who, "who", os.Getenv("USER"), "who to record the changes as made by")
+	fs.BoolVar(&dryRun, "dry-run", false, "show what would change without changing anything")
+	fs.StringVar(&denyDomains, "deny-domains", "", "comma separated domains shortlinks may not point to")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("a file to import is required")
+	}
+	file := fs.Arg(0)
+	if format == "" {
+		format = shortlinks.DumpFormat(file)
+	}
+
+	m, err := shortlinks.ParseImportMode(mode)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	d, err := shortlinks.ReadDump(f, format)
+	if err != nil {
+		return err
+	}
+
+	db, err := openDB(spec)
+	if err != nil {
+		return err
+	}
+
+	changes, err := shortlinks.PlanImport(db, d, m, shortlinks.ParseDomainList(denyDomains))
+	if err != nil {
+		return err
+	}
+
+	for _, w := range d.Warnings {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", w)
+	}
+
+	printChanges(changes)
+
+	if dryRun {
+		return nil
+	}
+
+	if err := shortlinks.ApplyImport(db, changes, who, "import"); err != nil {
+		return err
+	}
+	return closeDB(db)
+}
+
+// printChanges describes changes planned by shortlinks.PlanImport on stderr.
+func printChanges(changes []shortlinks.ImportChange) {
+	for _, c := range changes {
+		switch c.Action {
+		case shortlinks.ActionCreate, shortlinks.ActionAddDeleted:
+			fmt.Fprintf(os.Stderr, "%s %s → %s\n", c.Action, c.New.From, c.New.To)
+		case shortlinks.ActionUpdate, shortlinks.ActionSkip:
+			var conflict string
+			if c.Conflict() {
+				conflict = " (conflict)"
+			}
+			fmt.Fprintf(os.Stderr, "%s %s%s %s → %s\n", c.Action, c.New.From, conflict, c.Old.To, c.New.To)
+		case shortlinks.ActionDelete:
+			fmt.Fprintf(os.Stderr, "%s %s\n", c.Action, c.Old.From)
+		}
+	}
+	summary := shortlinks.ImportSummary(changes)
+	actions := make([]string, 0, len(summary))
+	for a := range summary {
+		actions = append(actions, string(a))
+	}
+	sort.Strings(actions)
+	for _, a := range actions {
+		fmt.Fprintf(os.Stderr, "%s: %d\n", a, summary[shortlinks.ImportAction(a)])
+	}
+}
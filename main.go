@@ -2,16 +2,30 @@ package main
 
 import (
 	"context"
+	"errors"
+	"expvar"
 	"flag"
 	"fmt"
+	"net/http"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"tailscale.com/client/tailscale"
+	"tailscale.com/tsnet"
 
+	"github.com/frioux/shortlinks/auth/headerauth"
+	"github.com/frioux/shortlinks/auth/oidcauth"
 	"github.com/frioux/shortlinks/auth/tailscaleauth"
+	"github.com/frioux/shortlinks/auth/tokenauth"
+	"github.com/frioux/shortlinks/declarative"
 	"github.com/frioux/shortlinks/shortlinks"
+	"github.com/frioux/shortlinks/storage/cachestorage"
 	"github.com/frioux/shortlinks/storage/dynamodbstorage"
+	"github.com/frioux/shortlinks/storage/memstorage"
+	"github.com/frioux/shortlinks/storage/pgstorage"
 	"github.com/frioux/shortlinks/storage/sqlitestorage"
 )
 
@@ -23,44 +37,146 @@ func main() {
 }
 
 func run() error {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "migrate":
+			return migrate(os.Args[2:])
+		case "migrate-times":
+			return migrateTimes(os.Args[2:])
+		case "export":
+			return export(os.Args[2:])
+		case "import":
+			return importCmd(os.Args[2:])
+		case "sync":
+			return syncCmd(os.Args[2:])
+		}
+	}
+
 	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
 	var (
-		publicListen, listen, dsn string
-		tailscale, useDDB         bool
+		publicListen, listen, dsn        string
+		useTailscale, useDDB, headerAuth bool
+		tokens, useTsnet, useMemory      bool
+		requireAuth, openRedirects       bool
+		autoRedirect                     bool
+
+		publicAllowDomains, denyDomains string
+
+		tailscaleCap string
+
+		admins string
+
+		tsnetHostname, tsnetDir, tsnetAuthKey string
+
+		oidcIssuer, oidcClientID, oidcClientSecret, oidcRedirectURL string
+		oidcAllowedDomains, oidcSessionKey                          string
+
+		headerUser, headerEmail, headerGroups string
+		headerProxies, headerAllowedGroups    string
 
 		ddbTable, ddbRegion string
+
+		pgDSN string
+
+		memorySnapshot string
+
+		cacheSize             int
+		cacheTTL, cacheNegTTL time.Duration
+
+		debugListen string
+
+		syncFile            string
+		syncInterval        time.Duration
+		syncPrune, syncPull bool
 	)
 
 	fs.StringVar(&listen, "listen", ":8080", "address to listen on for read-write server")
 	fs.StringVar(&publicListen, "public-listen", "", "address to listen on for public server")
 
+	fs.StringVar(&publicAllowDomains, "public-allow-domains", "", "comma separated domains the public server redirects to without an interstitial")
+	fs.StringVar(&denyDomains, "deny-domains", "", "comma separated domains shortlinks may not point to")
+
+	fs.BoolVar(&requireAuth, "require-auth", false, "require authentication for every page of the read-write server, not just changes")
+	fs.BoolVar(&openRedirects, "open-redirects", false, "with -require-auth, still let anyone follow shortlinks")
+
+	fs.BoolVar(&autoRedirect, "auto-redirect", false, "redirect missing shortlinks to the one existing shortlink that's very close, instead of suggesting it")
+
 	fs.StringVar(&dsn, "db", "file:db.db", "database file")
 
-	fs.BoolVar(&tailscale, "tailscale", false, "enable tailscale auth for read-write server")
+	fs.BoolVar(&useTailscale, "tailscale", false, "enable tailscale auth for read-write server")
+	fs.StringVar(&tailscaleCap, "tailscale-capability", "", "peer capability required to make changes when using tailscale auth")
+
+	fs.BoolVar(&useTsnet, "tsnet", false, "join the tailnet as its own node and serve the read-write server there")
+	fs.StringVar(&tsnetHostname, "tsnet-hostname", "go", "hostname of the tsnet node")
+	fs.StringVar(&tsnetDir, "tsnet-dir", "", "directory to store tsnet state in (defaults to a directory under the user config dir)")
+	fs.StringVar(&tsnetAuthKey, "tsnet-authkey", os.Getenv("TS_AUTHKEY"), "auth key used the first time the tsnet node joins the tailnet")
+
+	fs.StringVar(&oidcIssuer, "oidc-issuer", "", "enable OpenID Connect auth for read-write server using this issuer")
+	fs.StringVar(&oidcClientID, "oidc-client-id", "", "OpenID Connect client id")
+	fs.StringVar(&oidcClientSecret, "oidc-client-secret", os.Getenv("SHORTLINKS_OIDC_CLIENT_SECRET"), "OpenID Connect client secret")
+	fs.StringVar(&oidcRedirectURL, "oidc-redirect-url", "", "absolute URL of /_oidc/callback on the read-write server")
+	fs.StringVar(&oidcAllowedDomains, "oidc-allowed-domains", "", "comma separated email domains allowed to log in")
+	fs.StringVar(&oidcSessionKey, "oidc-session-key", os.Getenv("SHORTLINKS_OIDC_SESSION_KEY"), "key used to sign session cookies")
+
+	fs.BoolVar(&headerAuth, "header-auth", false, "enable auth via headers set by a trusted reverse proxy")
+	fs.StringVar(&headerUser, "header-auth-user", headerauth.DefaultUserHeader, "header containing the user")
+	fs.StringVar(&headerEmail, "header-auth-email", headerauth.DefaultEmailHeader, "header containing the user's email, used if the user header is empty")
+	fs.StringVar(&headerGroups, "header-auth-groups", headerauth.DefaultGroupsHeader, "header containing the user's comma separated groups")
+	fs.StringVar(&headerProxies, "header-auth-trusted-proxies", "127.0.0.1,::1", "comma separated CIDRs of proxies allowed to set auth headers")
+	fs.StringVar(&headerAllowedGroups, "header-auth-allowed-groups", "", "comma separated groups allowed to make changes")
+
+	fs.BoolVar(&tokens, "tokens", false, "accept API tokens (minted at /_tokens/) in addition to any other auth")
+	fs.StringVar(&admins, "admins", "", "comma separated users that may manage every API token and mint admin tokens")
+
+	fs.StringVar(&pgDSN, "postgres", "", "enable postgres for storage, connecting to this DSN")
+
+	fs.BoolVar(&useMemory, "memory", false, "store shortlinks in memory instead of a database")
+	fs.StringVar(&memorySnapshot, "memory-snapshot", "", "with -memory, persist to and load from this JSON file")
 
 	fs.BoolVar(&useDDB, "dynamodb", false, "enable dynamodb for storage")
 	fs.StringVar(&ddbTable, "dynamodb-table", "dev-zrorg--shortlinks", "table to use for DDB")
 	fs.StringVar(&ddbRegion, "dynamodb-region", "us-west-2", "region to use for DDB")
 
+	fs.IntVar(&cacheSize, "cache-size", 0, "cache up to this many shortlink lookups in memory (0 disables the cache)")
+	fs.DurationVar(&cacheTTL, "cache-ttl", time.Minute, "how long to cache shortlinks")
+	fs.DurationVar(&cacheNegTTL, "cache-negative-ttl", 10*time.Second, "how long to cache missing shortlinks")
+
+	fs.StringVar(&debugListen, "debug-listen", "", "address to serve expvar metrics (at /debug/vars) on")
+
+	fs.StringVar(&syncFile, "sync-file", "", "keep shortlinks in sync with this declarative YAML file, and don't allow editing them any other way")
+	fs.DurationVar(&syncInterval, "sync-interval", time.Minute, "how often to sync -sync-file")
+	fs.BoolVar(&syncPrune, "sync-prune", false, "delete links that were synced before but are no longer in -sync-file")
+	fs.BoolVar(&syncPull, "sync-pull", false, "git pull in the directory of -sync-file before every sync")
+
 	if err := fs.Parse(os.Args[1:]); err != nil {
 		return err
 	}
 
+	var listenSet bool
+	fs.Visit(func(f *flag.Flag) { listenSet = listenSet || f.Name == "listen" })
+
 	var (
 		db  shortlinks.DB
 		err error
 	)
-	if useDDB {
-		cfg, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion(ddbRegion))
+	if useMemory {
+		if memorySnapshot != "" {
+			db, err = memstorage.Open(memorySnapshot)
+			if err != nil {
+				return err
+			}
+		} else {
+			db = memstorage.New()
+		}
+	} else if useDDB {
+		db, err = dynamoDB(context.TODO(), ddbTable, ddbRegion)
 		if err != nil {
 			return err
 		}
-
-		svc := dynamodb.NewFromConfig(cfg)
-
-		db = &dynamodbstorage.Client{
-			DB:    svc,
-			Table: ddbTable,
+	} else if pgDSN != "" {
+		db, err = pgstorage.Connect(pgDSN)
+		if err != nil {
+			return err
 		}
 	} else {
 		db, err = sqlitestorage.Connect(dsn)
@@ -69,14 +185,153 @@ func run() error {
 		}
 	}
 
-	s := shortlinks.Server{DB: db}
-	if tailscale {
-		s.Auth = tailscaleauth.Auther{}
+	if cacheSize > 0 {
+		c := cachestorage.New(db, cachestorage.Config{
+			Size:        cacheSize,
+			TTL:         cacheTTL,
+			NegativeTTL: cacheNegTTL,
+		})
+		expvar.Publish("shortlinks_cache", expvar.Func(func() any {
+			s := c.Stats()
+			return map[string]any{
+				"hits":      s.Hits,
+				"misses":    s.Misses,
+				"evictions": s.Evictions,
+				"size":      s.Size,
+				"hit_rate":  s.HitRate(),
+			}
+		}))
+		db = c
+	}
+
+	var ts *tsnet.Server
+	if useTsnet {
+		ts = &tsnet.Server{
+			Hostname: tsnetHostname,
+			Dir:      tsnetDir,
+			AuthKey:  tsnetAuthKey,
+		}
+		defer ts.Close()
+
+		if !listenSet {
+			listen = ":80"
+		}
+	}
+
+	s := shortlinks.Server{
+		DB: db,
+
+		PublicAllowedDomains: shortlinks.ParseDomainList(publicAllowDomains),
+		DeniedDomains:        shortlinks.ParseDomainList(denyDomains),
+
+		Admins: strings.FieldsFunc(admins, func(r rune) bool { return r == ',' }),
+
+		RequireAuth:   requireAuth,
+		OpenRedirects: openRedirects,
+		AutoRedirect:  autoRedirect,
+	}
+	// Tokens go first, since they are only consulted when there's a
+	// bearer token, followed by the interactive methods.
+	var auths shortlinks.Chain
+	if tokens {
+		dbt, ok := shortlinks.As[shortlinks.DBTokens](db)
+		if !ok {
+			return errors.New("storage driver does not support tokens")
+		}
+		auths = append(auths, tokenauth.Auther{DB: dbt})
+	}
+	if headerAuth {
+		proxies, err := headerauth.ParsePrefixes(headerProxies)
+		if err != nil {
+			return err
+		}
+		auths = append(auths, headerauth.Auther{
+			UserHeader:   headerUser,
+			EmailHeader:  headerEmail,
+			GroupsHeader: headerGroups,
+
+			TrustedProxies: proxies,
+			AllowedGroups:  strings.FieldsFunc(headerAllowedGroups, func(r rune) bool { return r == ',' }),
+		})
+	}
+	if useTailscale {
+		var src tailscaleauth.WhoIser = &tailscale.LocalClient{}
+		if ts != nil {
+			lc, err := ts.LocalClient()
+			if err != nil {
+				return err
+			}
+			src = lc
+		}
+		auths = append(auths, tailscaleauth.Auther{
+			Source:     src,
+			Capability: tailscaleCap,
+		})
+	}
+	if oidcIssuer != "" {
+		a, err := oidcauth.New(context.TODO(), oidcauth.Config{
+			Issuer:       oidcIssuer,
+			ClientID:     oidcClientID,
+			ClientSecret: oidcClientSecret,
+			RedirectURL:  oidcRedirectURL,
+
+			AllowedDomains: strings.FieldsFunc(oidcAllowedDomains, func(r rune) bool { return r == ',' }),
+			SessionKey:     []byte(oidcSessionKey),
+		})
+		if err != nil {
+			return err
+		}
+		auths = append(auths, a)
+	}
+	if len(auths) != 0 {
+		s.Auth = auths
+	} else if requireAuth {
+		return errors.New("-require-auth needs at least one auth method enabled")
+	}
+
+	if ts != nil {
+		s.Listen = ts.Listen
+	}
+
+	if syncFile != "" {
+		syncer := &declarative.Syncer{
+			DB:    db,
+			Path:  syncFile,
+			Prune: syncPrune,
+			Pull:  syncPull,
+			Who:   "sync",
+
+			Denied: s.DeniedDomains,
+		}
+		// Load once up front so that a broken file is an error at startup
+		// and managed links are known before the server starts.
+		if _, err := syncer.Plan(); err != nil {
+			return err
+		}
+		s.Managed = syncer
+		go syncer.Run(context.Background(), syncInterval)
 	}
 
 	if publicListen != "" {
 		go s.PublicListenAndServe(publicListen)
 	}
 
+	if debugListen != "" {
+		// expvar registers /debug/vars on the default mux.
+		go http.ListenAndServe(debugListen, nil)
+	}
+
 	return s.ListenAndServe(listen)
 }
+
+func dynamoDB(ctx context.Context, table, region string) (*dynamodbstorage.Client, error) {
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
+	if err != nil {
+		return nil, err
+	}
+
+	return &dynamodbstorage.Client{
+		DB:    dynamodb.NewFromConfig(cfg),
+		Table: table,
+	}, nil
+}
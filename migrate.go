@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/frioux/shortlinks/shortlinks"
+	"github.com/frioux/shortlinks/storage/memstorage"
+	"github.com/frioux/shortlinks/storage/pgstorage"
+	"github.com/frioux/shortlinks/storage/sqlitestorage"
+)
+
+const dbSpecUsage = `databases are given as driver:location, one of:
+
+  sqlite:file:db.db
+  postgres:postgres://user@host/shortlinks?sslmode=disable
+  dynamodb:table?region=us-west-2
+  memory:snapshot.json`
+
+// migrate copies everything from one database to another; see
+// shortlinks.Copy.
+func migrate(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s migrate -from <db> -to <db> [-dry-run]\n\n", os.Args[0])
+		fs.PrintDefaults()
+		fmt.Fprintf(fs.Output(), "\n%s\n", dbSpecUsage)
+	}
+
+	var (
+		from, to string
+		dryRun   bool
+	)
+	fs.StringVar(&from, "from", "", "database to copy from")
+	fs.StringVar(&to, "to", "", "database to copy to, which must be empty")
+	fs.BoolVar(&dryRun, "dry-run", false, "read everything but don't write anything")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if from == "" || to == "" {
+		fs.Usage()
+		return errors.New("-from and -to are required")
+	}
+
+	src, err := openDB(from)
+	if err != nil {
+		return fmt.Errorf("couldn't open %s: %w", from, err)
+	}
+	dst, err := openDB(to)
+	if err != nil {
+		return fmt.Errorf("couldn't open %s: %w", to, err)
+	}
+
+	c, err := shortlinks.Copy(dst, src, shortlinks.CopyOptions{
+		DryRun:   dryRun,
+		Progress: os.Stderr,
+	})
+	if err != nil {
+		return err
+	}
+	if err := closeDB(dst); err != nil {
+		return err
+	}
+
+	if dryRun {
+		fmt.Fprintf(os.Stderr, "would have copied %s\n", c)
+	} else {
+		fmt.Fprintf(os.Stderr, "verified %s\n", c)
+	}
+	return nil
+}
+
+// migrateTimes rewrites history stored with times that don't sort, which
+// only DynamoDB needs; the other drivers migrate their schemas when opened.
+func migrateTimes(args []string) error {
+	fs := flag.NewFlagSet("migrate-times", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s migrate-times -db dynamodb:<table> [-dry-run]\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+
+	var (
+		spec   string
+		dryRun bool
+	)
+	fs.StringVar(&spec, "db", "", "database to migrate")
+	fs.BoolVar(&dryRun, "dry-run", false, "count what would be migrated but don't change anything")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if spec == "" {
+		fs.Usage()
+		return errors.New("-db is required")
+	}
+
+	db, err := openDB(spec)
+	if err != nil {
+		return fmt.Errorf("couldn't open %s: %w", spec, err)
+	}
+	m, ok := db.(interface {
+		MigrateHistoryTimes(ctx context.Context, dryRun bool) (int, error)
+	})
+	if !ok {
+		return fmt.Errorf("%s doesn't need its times migrated", spec)
+	}
+
+	n, err := m.MigrateHistoryTimes(context.Background(), dryRun)
+	if dryRun {
+		fmt.Fprintf(os.Stderr, "would have migrated %d history entries\n", n)
+	} else {
+		fmt.Fprintf(os.Stderr, "migrated %d history entries\n", n)
+	}
+	return err
+}
+
+// closeDB closes db if it needs closing, like the memory driver, which only
+// snapshots some changes on Close.
+func closeDB(db shortlinks.DB) error {
+	if c, ok := db.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// openDB opens the database described by spec; see dbSpecUsage.
+func openDB(spec string) (shortlinks.DB, error) {
+	driver, location, ok := strings.Cut(spec, ":")
+	if !ok {
+		return nil, fmt.Errorf("invalid database %q\n\n%s", spec, dbSpecUsage)
+	}
+
+	switch driver {
+	case "sqlite":
+		return sqlitestorage.Connect(location)
+	case "postgres":
+		return pgstorage.Connect(location)
+	case "memory":
+		return memstorage.Open(location)
+	case "dynamodb":
+		table, query, _ := strings.Cut(location, "?")
+		q, err := url.ParseQuery(query)
+		if err != nil {
+			return nil, err
+		}
+		region := q.Get("region")
+		if region == "" {
+			region = "us-west-2"
+		}
+		return dynamoDB(context.TODO(), table, region)
+	default:
+		return nil, fmt.Errorf("unknown driver %q\n\n%s", driver, dbSpecUsage)
+	}
+}
@@ -1,7 +1,9 @@
 package shortlinks
 
 import (
+	"errors"
 	"net/http"
+	"strings"
 )
 
 type Auth interface {
@@ -12,3 +14,126 @@ type Auth interface {
 	// User extracts the user from the http.Request.
 	User(*http.Request) (string, error)
 }
+
+// NamedAuth is optionally implemented by Auth drivers to name their
+// authentication method (eg "tailscale" or "token"), which is recorded in
+// History.
+type NamedAuth interface {
+	Name() string
+}
+
+// AuthLogin is optionally implemented by Auth drivers that have an
+// interactive login flow; unauthenticated users are sent to LoginURL when
+// authentication is required.
+type AuthLogin interface {
+	// LoginURL returns the URL to log in at, returning to r afterwards.
+	LoginURL(r *http.Request) string
+}
+
+// Chain is an Auth that tries each of its Auths in order, using the first one
+// that identifies the user.  All of the Auths' Wrap middleware is applied,
+// with the first Auth outermost.
+type Chain []Auth
+
+func (c Chain) Wrap(h http.Handler) http.Handler {
+	for i := len(c) - 1; i >= 0; i-- {
+		h = c[i].Wrap(h)
+	}
+	return h
+}
+
+func (c Chain) User(r *http.Request) (string, error) {
+	u, _, err := c.UserMethod(r)
+	return u, err
+}
+
+// UserMethod is like User but also returns the name of the Auth that
+// identified the user.
+func (c Chain) UserMethod(r *http.Request) (string, string, error) {
+	if len(c) == 0 {
+		return "", "", errors.New("no auth methods configured")
+	}
+
+	var errs []string
+	for _, a := range c {
+		u, m, err := authenticate(a, r)
+		if err == nil {
+			return u, m, nil
+		}
+		errs = append(errs, err.Error())
+	}
+
+	return "", "", errors.New("no auth method succeeded: " + strings.Join(errs, "; "))
+}
+
+// LoginURL returns the login URL of the first Auth in the chain that has
+// one, or empty string.
+func (c Chain) LoginURL(r *http.Request) string {
+	for _, a := range c {
+		if l, ok := a.(AuthLogin); ok {
+			return l.LoginURL(r)
+		}
+	}
+	return ""
+}
+
+// requireAuth only lets authenticated requests through to inner, except for
+// redirects to shortlinks that exist in db when openRedirects is set.  Misses
+// still need authentication, since they suggest other shortlinks.
+func requireAuth(auth Auth, db PublicDB, openRedirects bool, inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/_favicon" || (openRedirects && isRedirect(db, r.URL.Path)) {
+			inner.ServeHTTP(w, r)
+			return
+		}
+
+		if _, _, err := authenticate(auth, r); err != nil {
+			if l, ok := auth.(AuthLogin); ok && r.Method == "GET" {
+				if u := l.LoginURL(r); u != "" {
+					w.Header().Add("Location", u)
+					w.WriteHeader(302)
+					return
+				}
+			}
+			_403(w, err)
+			return
+		}
+
+		inner.ServeHTTP(w, r)
+	})
+}
+
+// isRedirect returns true if path is a shortlink in db rather than one of the
+// server's own pages or a miss.
+func isRedirect(db PublicDB, path string) bool {
+	if path == "/" || strings.HasPrefix(path, "/_") {
+		return false
+	}
+	from, _ := split(path)
+	sl, err := db.Shortlink(from)
+	return err == nil && sl.From != ""
+}
+
+// authenticate returns the user and authentication method for r.  A nil
+// auth authenticates everyone as the empty user.
+func authenticate(auth Auth, r *http.Request) (string, string, error) {
+	if auth == nil {
+		return "", "", nil
+	}
+
+	if c, ok := auth.(Chain); ok {
+		return c.UserMethod(r)
+	}
+
+	u, err := auth.User(r)
+	if err != nil {
+		return "", "", err
+	}
+
+	var m string
+	if n, ok := auth.(NamedAuth); ok {
+		m = n.Name()
+	}
+
+	return u, m, nil
+}
@@ -0,0 +1,120 @@
+package shortlinks
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type headerAuth struct{ header, name string }
+
+func (a headerAuth) Name() string { return a.name }
+
+func (a headerAuth) Wrap(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Header.Add("X-Order", a.name)
+		h.ServeHTTP(w, r)
+	})
+}
+
+func (a headerAuth) User(r *http.Request) (string, error) {
+	if u := r.Header.Get(a.header); u != "" {
+		return u, nil
+	}
+	return "", errors.New(a.name + " failed")
+}
+
+func TestChain(t *testing.T) {
+	c := Chain{headerAuth{"X-A", "a"}, headerAuth{"X-B", "b"}}
+
+	var order string
+	c.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		order = strings.Join(r.Header.Values("X-Order"), ",")
+	})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if order != "a,b" {
+		t.Errorf("expected middleware to run in order a,b; got %s", order)
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-B", "frew")
+	if u, m, err := authenticate(c, r); err != nil || u != "frew" || m != "b" {
+		t.Errorf("expected frew via b, got %q via %q (%v)", u, m, err)
+	}
+
+	r.Header.Set("X-A", "alice")
+	if u, m, err := authenticate(c, r); err != nil || u != "alice" || m != "a" {
+		t.Errorf("expected alice via a, got %q via %q (%v)", u, m, err)
+	}
+
+	r = httptest.NewRequest("GET", "/", nil)
+	if _, _, err := authenticate(c, r); err == nil || !strings.Contains(err.Error(), "a failed; b failed") {
+		t.Errorf("expected combined error, got %v", err)
+	}
+}
+
+type loginAuth struct{ headerAuth }
+
+func (loginAuth) LoginURL(r *http.Request) string { return "/_login?next=" + r.URL.Path }
+
+// links is a PublicDB of shortlinks pointing at example.com.
+type links []string
+
+func (l links) Shortlink(from string) (Shortlink, error) {
+	for _, f := range l {
+		if f == from {
+			return Shortlink{From: f, To: "https://example.com/" + f}, nil
+		}
+	}
+	return Shortlink{}, nil
+}
+
+func (l links) AllShortlinks() ([]Shortlink, error) {
+	var ret []Shortlink
+	for _, f := range l {
+		ret = append(ret, Shortlink{From: f, To: "https://example.com/" + f})
+	}
+	return ret, nil
+}
+
+func TestRequireAuth(t *testing.T) {
+	db := links{"foo"}
+	inner := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	cases := []struct {
+		name, method, path, user string
+		auth                     Auth
+		open                     bool
+		code                     int
+		location                 string
+	}{
+		{name: "index", method: "GET", path: "/", auth: headerAuth{"X-A", "a"}, code: 403},
+		{name: "index authed", method: "GET", path: "/", user: "frew", auth: headerAuth{"X-A", "a"}, code: 200},
+		{name: "favicon", method: "GET", path: "/_favicon", auth: headerAuth{"X-A", "a"}, code: 200},
+		{name: "redirect", method: "GET", path: "/foo", auth: headerAuth{"X-A", "a"}, code: 403},
+		{name: "open redirect", method: "GET", path: "/foo", auth: headerAuth{"X-A", "a"}, open: true, code: 200},
+		{name: "open redirect substitution", method: "GET", path: "/foo/bar", auth: headerAuth{"X-A", "a"}, open: true, code: 200},
+		{name: "open redirect miss", method: "GET", path: "/fo", auth: headerAuth{"X-A", "a"}, open: true, code: 403},
+		{name: "open redirect miss authed", method: "GET", path: "/fo", user: "frew", auth: headerAuth{"X-A", "a"}, open: true, code: 200},
+		{name: "open redirect index", method: "GET", path: "/_deleted/", auth: headerAuth{"X-A", "a"}, open: true, code: 403},
+		{name: "login", method: "GET", path: "/_deleted/", auth: Chain{loginAuth{headerAuth{"X-A", "a"}}}, code: 302, location: "/_login?next=/_deleted/"},
+		{name: "login post", method: "POST", path: "/_edit/", auth: loginAuth{headerAuth{"X-A", "a"}}, code: 403},
+	}
+
+	for _, c := range cases {
+		r := httptest.NewRequest(c.method, c.path, nil)
+		if c.user != "" {
+			r.Header.Set("X-A", c.user)
+		}
+		w := httptest.NewRecorder()
+		requireAuth(c.auth, db, c.open, inner).ServeHTTP(w, r)
+
+		if w.Code != c.code {
+			t.Errorf("%s: expected %d, got %d", c.name, c.code, w.Code)
+		}
+		if l := w.Header().Get("Location"); l != c.location {
+			t.Errorf("%s: expected location %q, got %q", c.name, c.location, l)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package shortlinks
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// WhenFormat is RFC3339 with a fixed number of fractional digits, so that
+// UTC times formatted with it sort as strings.  Drivers that store times as
+// strings use it; see FormatWhen.
+const WhenFormat = "2006-01-02T15:04:05.000000000Z07:00"
+
+// FormatWhen formats t in UTC with WhenFormat.
+func FormatWhen(t time.Time) string { return t.UTC().Format(WhenFormat) }
+
+// whenFormats are the formats times have been stored in, by drivers and in
+// dumps: RFC3339 (which includes WhenFormat), SQLite's CURRENT_TIMESTAMP,
+// and time.Time.String.
+var whenFormats = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04:05.999999999 -0700 MST",
+}
+
+// ParseWhen parses a time in any format it has been stored in, for reading
+// old data.  Times without a zone are UTC.
+func ParseWhen(when string) (time.Time, error) {
+	// time.Time.String includes the monotonic clock reading, which
+	// time.Parse doesn't understand.
+	if i := strings.Index(when, " m="); i != -1 {
+		when = when[:i]
+	}
+
+	for _, f := range whenFormats {
+		if t, err := time.Parse(f, when); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("couldn't parse time (%s)", when)
+}
+
+// CopyOptions configure Copy.
+type CopyOptions struct {
+	// DryRun reads everything from the source but writes nothing.
+	DryRun bool
+
+	// Progress, if set, gets a line of output every so often.
+	Progress io.Writer
+}
+
+// CopyCounts is how much was copied by Copy.
+type CopyCounts struct {
+	Shortlinks, Deleted, History, Tokens int
+}
+
+func (c CopyCounts) String() string {
+	return fmt.Sprintf("%d shortlinks, %d deleted shortlinks, %d history entries, %d tokens",
+		c.Shortlinks, c.Deleted, c.History, c.Tokens)
+}
+
+// Copy copies all shortlinks, deleted shortlinks, their history, any API
+// tokens and hits from src to dst, preserving when and by whom every change
+// was made.  dst must be empty and implement DBLoader.  Deleted shortlinks,
+// tokens and hits are only copied if both drivers support them.
+//
+// Once done the counts in dst are checked against what was copied.
+func Copy(dst, src DB, o CopyOptions) (CopyCounts, error) {
+	var c CopyCounts
+
+	progress := func(format string, args ...interface{}) {
+		if o.Progress != nil {
+			fmt.Fprintf(o.Progress, format+"\n", args...)
+		}
+	}
+
+	l, ok := As[DBLoader](dst)
+	if !ok {
+		return c, errors.New("destination driver does not support loading")
+	}
+
+	if existing, err := dst.AllShortlinks(); err != nil {
+		return c, err
+	} else if len(existing) != 0 {
+		return c, errors.New("destination is not empty")
+	}
+
+	live, err := src.AllShortlinks()
+	if err != nil {
+		return c, err
+	}
+
+	var deleted []Shortlink
+	srcd, srcOK := As[DBDeleted](src)
+	_, dstOK := As[DBDeleted](dst)
+	if srcOK && dstOK {
+		deleted, err = srcd.DeletedShortlinks()
+		if err != nil {
+			return c, err
+		}
+	} else if srcOK {
+		progress("destination does not support deleted shortlinks, skipping them")
+	}
+
+	// Deleted shortlinks go first so that if a driver somehow has a
+	// shortlink both live and deleted, it ends up live.
+	type item struct {
+		sl      Shortlink
+		deleted bool
+	}
+	items := make([]item, 0, len(deleted)+len(live))
+	for _, sl := range deleted {
+		items = append(items, item{sl, true})
+	}
+	for _, sl := range live {
+		items = append(items, item{sl, false})
+	}
+
+	histories := map[string]int{}
+	for i, it := range items {
+		if !o.DryRun {
+			if err := l.LoadShortlink(it.sl, it.deleted); err != nil {
+				return c, err
+			}
+		}
+		if it.deleted {
+			c.Deleted++
+		} else {
+			c.Shortlinks++
+		}
+
+		if _, ok := histories[it.sl.From]; !ok {
+			n, err := copyHistory(l, src, it.sl.From, o.DryRun)
+			if err != nil {
+				return c, err
+			}
+			histories[it.sl.From] = n
+			c.History += n
+		}
+
+		if (i+1)%100 == 0 {
+			progress("copied %d/%d shortlinks", i+1, len(items))
+		}
+	}
+
+	srct, srcOK := As[DBTokens](src)
+	dstt, dstOK := As[DBTokens](dst)
+	if srcOK && dstOK {
+		ts, err := srct.Tokens()
+		if err != nil {
+			return c, err
+		}
+		for _, t := range ts {
+			if !o.DryRun {
+				if err := dstt.CreateToken(t); err != nil {
+					return c, err
+				}
+			}
+			c.Tokens++
+		}
+	}
+
+	srch, srcOK := As[DBHits](src)
+	dsth, dstOK := As[DBHits](dst)
+	if srcOK && dstOK {
+		hits, err := srch.Hits()
+		if err != nil {
+			return c, err
+		}
+		for from, n := range hits {
+			if !o.DryRun {
+				if err := dsth.AddHits(from, n); err != nil {
+					return c, err
+				}
+			}
+		}
+	}
+
+	progress("copied %s", c)
+
+	if o.DryRun {
+		return c, nil
+	}
+
+	return c, verifyCopy(dst, c, histories)
+}
+
+// copyHistory copies the history of from and returns how many entries there
+// were.
+func copyHistory(l DBLoader, src DB, from string, dryRun bool) (int, error) {
+	hs, err := src.History(from)
+	if err != nil {
+		return 0, err
+	}
+
+	var prev time.Time
+	for i, h := range hs {
+		// Some drivers key history by time, so nudge entries that
+		// happened at the same time apart rather than lose them.  That
+		// includes unknown (zero) times.
+		if i > 0 && !h.When.After(prev) {
+			h.When = prev.Add(time.Nanosecond)
+		}
+		prev = h.When
+
+		if !dryRun {
+			if err := l.LoadHistory(h); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	return len(hs), nil
+}
+
+func verifyCopy(dst DB, c CopyCounts, histories map[string]int) error {
+	live, err := dst.AllShortlinks()
+	if err != nil {
+		return err
+	}
+	if len(live) != c.Shortlinks {
+		return fmt.Errorf("copied %d shortlinks but destination has %d", c.Shortlinks, len(live))
+	}
+
+	if dstd, ok := As[DBDeleted](dst); ok {
+		deleted, err := dstd.DeletedShortlinks()
+		if err != nil {
+			return err
+		}
+		if len(deleted) != c.Deleted {
+			return fmt.Errorf("copied %d deleted shortlinks but destination has %d", c.Deleted, len(deleted))
+		}
+	}
+
+	for from, n := range histories {
+		hs, err := dst.History(from)
+		if err != nil {
+			return err
+		}
+		if len(hs) != n {
+			return fmt.Errorf("copied %d history entries for %s but destination has %d", n, from, len(hs))
+		}
+	}
+
+	if dstt, ok := As[DBTokens](dst); ok && c.Tokens != 0 {
+		ts, err := dstt.Tokens()
+		if err != nil {
+			return err
+		}
+		if len(ts) != c.Tokens {
+			return fmt.Errorf("copied %d tokens but destination has %d", c.Tokens, len(ts))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,148 @@
+package shortlinks_test
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/frioux/shortlinks/shortlinks"
+	"github.com/frioux/shortlinks/storage/memstorage"
+	"github.com/frioux/shortlinks/storage/sqlitestorage"
+)
+
+func TestParseWhen(t *testing.T) {
+	want := time.Date(2019, 4, 1, 12, 30, 0, 0, time.UTC)
+	for _, in := range []string{
+		"2019-04-01 12:30:00",
+		"2019-04-01T12:30:00Z",
+		"2019-04-01T05:30:00-07:00",
+		"2019-04-01 05:30:00 -0700 PDT",
+		"2019-04-01 05:30:00 -0700 PDT m=+0.012345678",
+	} {
+		got, err := shortlinks.ParseWhen(in)
+		if err != nil || !got.Equal(want) {
+			t.Errorf("ParseWhen(%q) = %s (%v), expected %s", in, got, err, want)
+		}
+	}
+
+	if _, err := shortlinks.ParseWhen("yesterday"); err == nil {
+		t.Error("expected an error parsing garbage")
+	}
+}
+
+func TestFormatWhen(t *testing.T) {
+	pst := time.FixedZone("PST", -8*60*60)
+	times := []time.Time{
+		time.Date(2019, 4, 1, 12, 30, 0, 0, time.UTC),
+		time.Date(2019, 4, 1, 5, 0, 0, 500, pst),
+		time.Date(2019, 4, 1, 13, 30, 0, 0, time.UTC),
+		time.Date(2019, 4, 1, 13, 30, 0, 100000000, time.UTC),
+	}
+	for i, tm := range times {
+		s := shortlinks.FormatWhen(tm)
+		if len(s) != len(shortlinks.WhenFormat)-len("Z07:00")+len("Z") {
+			t.Errorf("expected %s to be fixed width, got %q", tm, s)
+		}
+		if got, err := shortlinks.ParseWhen(s); err != nil || !got.Equal(tm) {
+			t.Errorf("ParseWhen(%q) = %s (%v), expected %s", s, got, err, tm)
+		}
+		if i > 0 && shortlinks.FormatWhen(times[i-1]) >= s {
+			t.Errorf("expected %q to sort after %q", s, shortlinks.FormatWhen(times[i-1]))
+		}
+	}
+}
+
+func TestCopy(t *testing.T) {
+	src := memstorage.New()
+	src.CreateShortlink(shortlinks.Shortlink{From: "a", To: "https://a.com", Description: "A"})
+	src.InsertHistory(shortlinks.History{From: "a", To: "https://a.com", Who: "frew", Method: "test"})
+	src.CreateShortlink(shortlinks.Shortlink{From: "b", To: "https://b.com"})
+	src.InsertHistory(shortlinks.History{From: "b", To: "https://b.com", Who: "alice"})
+	src.InsertHistory(shortlinks.History{From: "b", To: "https://b.com", Who: "bob"})
+	src.DeleteShortlink("b", "frew", "test")
+	_, tok := shortlinks.NewToken("ci", "frew", []string{shortlinks.ScopeRead}, 0)
+	src.CreateToken(tok)
+	src.AddHits("a", 3)
+
+	dst, err := sqlitestorage.Connect("file:" + filepath.Join(t.TempDir(), "db.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := shortlinks.Copy(dst, src, shortlinks.CopyOptions{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c != (shortlinks.CopyCounts{Shortlinks: 1, Deleted: 1, History: 4, Tokens: 1}) {
+		t.Errorf("unexpected counts: %+v", c)
+	}
+	if all, _ := dst.AllShortlinks(); len(all) != 0 {
+		t.Errorf("expected dry run to not write anything, got %+v", all)
+	}
+
+	var progress bytes.Buffer
+	if _, err := shortlinks.Copy(dst, src, shortlinks.CopyOptions{Progress: &progress}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(progress.String(), "copied 1 shortlinks, 1 deleted shortlinks, 4 history entries, 1 tokens") {
+		t.Errorf("unexpected progress: %s", progress.String())
+	}
+
+	if sl, _ := dst.Shortlink("a"); !sl.Equal(shortlinks.Shortlink{From: "a", To: "https://a.com", Description: "A"}) {
+		t.Errorf("unexpected shortlink: %+v", sl)
+	}
+	if del, _ := dst.DeletedShortlinks(); len(del) != 1 || del[0].From != "b" {
+		t.Errorf("unexpected deleted shortlinks: %+v", del)
+	}
+
+	srcH, _ := src.History("b")
+	dstH, _ := dst.History("b")
+	if len(dstH) != 3 {
+		t.Fatalf("unexpected history: %+v", dstH)
+	}
+	for i := range srcH {
+		if !reflect.DeepEqual(srcH[i], dstH[i]) {
+			t.Errorf("expected history to be preserved, got %+v, expected %+v", dstH[i], srcH[i])
+		}
+	}
+
+	if got, _ := dst.TokenByHash(tok.Hash); got.ID != tok.ID {
+		t.Errorf("expected token to be copied, got %+v", got)
+	}
+
+	if hits, _ := dst.Hits(); hits["a"] != 3 {
+		t.Errorf("expected hits to be copied, got %v", hits)
+	}
+
+	if _, err := shortlinks.Copy(dst, src, shortlinks.CopyOptions{}); err == nil {
+		t.Error("expected copying into a non-empty destination to fail")
+	}
+}
+
+// TestCopyUnknownTimes makes sure history with unknown (zero) times is nudged
+// apart like any other, so that drivers keyed by time don't lose any.
+func TestCopyUnknownTimes(t *testing.T) {
+	src := memstorage.New()
+	src.CreateShortlink(shortlinks.Shortlink{From: "a", To: "https://a.com"})
+	src.LoadHistory(shortlinks.History{From: "a", To: "https://a.org"})
+	src.LoadHistory(shortlinks.History{From: "a", To: "https://a.net"})
+	src.LoadHistory(shortlinks.History{From: "a", To: "https://a.com"})
+
+	dst := memstorage.New()
+	if _, err := shortlinks.Copy(dst, src, shortlinks.CopyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	hs, _ := dst.History("a")
+	if len(hs) != 3 || !hs[0].When.IsZero() {
+		t.Fatalf("unexpected history: %+v", hs)
+	}
+	for i := 1; i < len(hs); i++ {
+		if !hs[i].When.After(hs[i-1].When) {
+			t.Errorf("expected %s to be after %s", hs[i].When, hs[i-1].When)
+		}
+	}
+}
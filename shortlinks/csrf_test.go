@@ -0,0 +1,76 @@
+package shortlinks
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+type exemptAuth struct{ headerAuth }
+
+func (exemptAuth) CSRFExempt(r *http.Request) bool {
+	return r.Header.Get("Authorization") == "Bearer ok"
+}
+
+func TestCSRF(t *testing.T) {
+	var seen string
+	h := csrfProtect(Chain{exemptAuth{}}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = csrfToken(r)
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != 200 {
+		t.Fatalf("expected GET to succeed, got %d", w.Code)
+	}
+	cs := w.Result().Cookies()
+	if len(cs) != 1 || cs[0].Name != csrfCookie || cs[0].SameSite != http.SameSiteStrictMode {
+		t.Fatalf("expected a strict csrf cookie, got %v", cs)
+	}
+	token := cs[0].Value
+	if seen != token {
+		t.Errorf("expected handler to see token %q, got %q", token, seen)
+	}
+
+	cases := []struct {
+		name, form, origin, referer, auth string
+		code                              int
+	}{
+		{name: "valid", form: token, code: 200},
+		{name: "valid same origin", form: token, origin: "http://example.com", code: 200},
+		{name: "valid same referer", form: token, referer: "http://example.com/_edit/?from=x", code: 200},
+		{name: "missing", code: 403},
+		{name: "wrong", form: "nope", code: 403},
+		{name: "cross origin", form: token, origin: "https://evil.com", code: 403},
+		{name: "cross referer", form: token, referer: "https://evil.com/", code: 403},
+		{name: "token auth", auth: "Bearer ok", code: 200},
+		{name: "bad token auth", auth: "Bearer nope", code: 403},
+	}
+
+	for _, c := range cases {
+		body := url.Values{"from": {"x"}}
+		if c.form != "" {
+			body.Set(csrfField, c.form)
+		}
+		r := httptest.NewRequest("POST", "/_edit/", strings.NewReader(body.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.AddCookie(&http.Cookie{Name: csrfCookie, Value: token})
+		if c.origin != "" {
+			r.Header.Set("Origin", c.origin)
+		}
+		if c.referer != "" {
+			r.Header.Set("Referer", c.referer)
+		}
+		if c.auth != "" {
+			r.Header.Set("Authorization", c.auth)
+		}
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != c.code {
+			t.Errorf("%s: expected %d, got %d", c.name, c.code, w.Code)
+		}
+	}
+}
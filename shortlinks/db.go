@@ -1,28 +1,79 @@
 package shortlinks
 
+import (
+	"slices"
+	"time"
+)
+
 // Shortlink redirects a user from /From to To.
 type Shortlink struct {
 	From, To, Description string
+
+	// Tags categorize shortlinks; see ParseTags.
+	Tags []string
+
+	// CreatedAt and CreatedBy are when and by whom the shortlink was
+	// created, and UpdatedAt and UpdatedBy when and by whom it was last
+	// changed.  They are zero for shortlinks that predate them and have no
+	// history to fill them in from.
+	CreatedAt, UpdatedAt time.Time
+	CreatedBy, UpdatedBy string
+}
+
+// Equal is true if s and o are the same in every field but the timestamps
+// and authors, which record changes rather than being changed.
+func (s Shortlink) Equal(o Shortlink) bool {
+	return s.From == o.From && s.To == o.To && s.Description == o.Description && slices.Equal(s.Tags, o.Tags)
+}
+
+// touched returns s as changed by who just now, and also created by who just
+// now unless it already has a CreatedAt.
+func (s Shortlink) touched(who string) Shortlink {
+	s.UpdatedAt = time.Now().UTC()
+	s.UpdatedBy = who
+	if s.CreatedAt.IsZero() {
+		s.CreatedAt, s.CreatedBy = s.UpdatedAt, s.UpdatedBy
+	}
+	return s
 }
 
 // History represents a given version of a Shortlink.
 type History struct {
-	From, To, When, Who, Description string
+	From, To, Who, Description string
+
+	// When is when the change was made.
+	When time.Time
+
+	// Method is the name of the Auth used to make this change, if known.
+	Method string
+
+	// Tags are the tags the shortlink had as of this change.
+	Tags []string
 }
 
+// DeletedDescription is the Description of the History recorded when a
+// shortlink is deleted.  The To of that History is what the shortlink pointed
+// to when it was deleted.
+const DeletedDescription = "«deleted»"
+
 // DB is used by the Server to store shortlinks and related history.  May
 // optionally be a DBDeleted.
 type DB interface {
 	PublicDB
 
-	// CreateShortlink inserts or updates Shortlink.
+	// CreateShortlink inserts or updates Shortlink.  Creating a shortlink
+	// that was deleted restores it.  Updating a shortlink keeps its
+	// CreatedAt and CreatedBy, ignoring those passed in.
 	CreateShortlink(Shortlink) error
 
-	// DeleteShortlink deletes a shortlink from the database.
-	DeleteShortlink(from, who string) error
+	// DeleteShortlink deletes a shortlink from the database and records a
+	// History with the old To and a Description of DeletedDescription.
+	// who and method are recorded in the history, as in History.  Deleting
+	// a shortlink that doesn't exist is not an error.
+	DeleteShortlink(from, who, method string) error
 
-	// History loads history for a given shortlink.  Hardcoding a nil
-	// return value is supported.
+	// History loads history for a given shortlink, oldest first.
+	// Hardcoding a nil return value is supported.
 	History(from string) ([]History, error)
 
 	// InsertHistory stores the history for a newly inserted/updated
@@ -31,15 +82,134 @@ type DB interface {
 }
 
 type PublicDB interface {
-	// Shortlink loads data for from.
+	// Shortlink loads data for from.  If there is no such shortlink the
+	// zero Shortlink is returned.
 	Shortlink(from string) (Shortlink, error)
 
-	// AllShortlinks loads a list of shortlinks for use in the index.
-	// Hardcoding a nil return value is supported.
+	// AllShortlinks loads a list of shortlinks for use in the index,
+	// ordered by From.  Hardcoding a nil return value is supported.
 	AllShortlinks() ([]Shortlink, error)
 }
 
 type DBDeleted interface {
-	// DeletedShortlinks returns all deleted shortlinks.
+	// DeletedShortlinks returns all deleted shortlinks, ordered by From.
 	DeletedShortlinks() ([]Shortlink, error)
 }
+
+// DBTokens is implemented by drivers that can store API tokens.  Tokens are
+// only stored hashed; see HashToken.
+type DBTokens interface {
+	// CreateToken stores a newly minted token.
+	CreateToken(Token) error
+
+	// TokenByHash loads the token with the given hash.  If there is no
+	// such token the zero Token is returned.
+	TokenByHash(hash string) (Token, error)
+
+	// Tokens returns all tokens.
+	Tokens() ([]Token, error)
+
+	// RevokeToken deletes the token with the given ID.
+	RevokeToken(id string) error
+}
+
+// DBLoader is implemented by drivers that can be the destination of Copy.
+// Unlike CreateShortlink and InsertHistory nothing is filled in by the
+// driver, so data can be moved between drivers without losing anything.
+type DBLoader interface {
+	// LoadShortlink stores sl, as a deleted shortlink if deleted is set.
+	LoadShortlink(sl Shortlink, deleted bool) error
+
+	// LoadHistory stores h, including its When.
+	LoadHistory(h History) error
+}
+
+// DBPager is implemented by drivers that can load shortlinks a page at a
+// time, so that the index doesn't have to load all of them.
+type DBPager interface {
+	// ShortlinksPage returns up to limit shortlinks with a From after
+	// after, ordered by From, and the after of the next page, which is
+	// empty if there are no more.  It may return an empty last page.
+	ShortlinksPage(after string, limit int) (sls []Shortlink, next string, err error)
+}
+
+// DBAuthorPager is implemented by DBPagers that can also filter by who
+// created or last updated shortlinks.
+type DBAuthorPager interface {
+	// ShortlinksPageByAuthor is like ShortlinksPage, but only returns
+	// shortlinks with a CreatedBy or UpdatedBy of author.
+	ShortlinksPageByAuthor(author, after string, limit int) (sls []Shortlink, next string, err error)
+}
+
+// Page is a helper for DBPager implementations: given shortlinks ordered by
+// From, it returns the first limit of them and, if there are more, the next
+// after.  Load limit+1 to find out whether there are more.
+func Page(sls []Shortlink, limit int) ([]Shortlink, string) {
+	if len(sls) <= limit {
+		return sls, ""
+	}
+	sls = sls[:limit]
+	return sls, sls[limit-1].From
+}
+
+// DBHits is implemented by drivers that can count redirects to each
+// shortlink, which the server uses as a measure of popularity.  Without it
+// every shortlink is as popular as every other.
+type DBHits interface {
+	// AddHits adds n to the hits of from.
+	AddHits(from string, n int) error
+
+	// Hits returns the hits of every shortlink that has had any.
+	Hits() (map[string]int, error)
+}
+
+// DBPopularPager is implemented by DBHits drivers that can load shortlinks a
+// page at a time ordered by hits, so that the index sorted by popularity
+// doesn't have to load all of them.
+type DBPopularPager interface {
+	// ShortlinksPageByHits returns up to limit shortlinks, most hits
+	// first and then ordered by From, skipping the first offset, and
+	// whether there are more.
+	ShortlinksPageByHits(offset, limit int) (sls []Shortlink, more bool, err error)
+}
+
+// DBSearch is implemented by drivers that can find shortlinks matching a
+// query faster than scanning all of them, for example with a full text index.
+// See Search.
+type DBSearch interface {
+	// SearchShortlinks returns shortlinks with a From, To, Description or
+	// tag containing a word that starts with any of terms, which are lower
+	// case.  Order doesn't matter.
+	SearchShortlinks(terms []string) ([]Shortlink, error)
+}
+
+// Managed reports which shortlinks are managed outside of the server, for
+// example by declarative config, and so can't be changed through it.
+type Managed interface {
+	Managed(from string) bool
+}
+
+// Unwrapper is implemented by drivers that decorate another driver, like a
+// cache, so that the optional interfaces of the wrapped driver can still be
+// found with As.
+type Unwrapper interface {
+	Unwrap() PublicDB
+}
+
+// As finds the first driver in db's chain of Unwrappers that implements T,
+// much like errors.As.
+func As[T any](db PublicDB) (T, bool) {
+	for db != nil {
+		if t, ok := db.(T); ok {
+			return t, true
+		}
+		u, ok := db.(Unwrapper)
+		if !ok {
+			break
+		}
+		db = u.Unwrap()
+	}
+
+	var zero T
+	return zero, false
+}
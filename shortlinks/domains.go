@@ -0,0 +1,75 @@
+package shortlinks
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// DomainList is a list of domains used to decide where shortlinks may point.
+// Each entry matches itself and all of its subdomains, so "example.com"
+// matches both "example.com" and "docs.example.com".
+type DomainList []string
+
+// ParseDomainList splits a comma separated list of domains, as passed on the
+// command line, into a DomainList.
+func ParseDomainList(s string) DomainList {
+	var ret DomainList
+	for _, d := range strings.Split(s, ",") {
+		d = strings.Trim(strings.ToLower(strings.TrimSpace(d)), ".")
+		if d == "" {
+			continue
+		}
+		ret = append(ret, d)
+	}
+	return ret
+}
+
+// Match returns true if host is one of the domains in l or a subdomain of
+// one of them.
+func (l DomainList) Match(host string) bool {
+	host = strings.Trim(strings.ToLower(host), ".")
+	if host == "" {
+		return false
+	}
+	for _, d := range l {
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// destinationHost returns the hostname a To value points at, or empty string
+// if it can't be determined.
+func destinationHost(to string) string {
+	// %s isn't a valid escape, so fill it in before parsing.
+	u, err := url.Parse(strings.ReplaceAll(to, "%s", "x"))
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+// Allow returns an error if l denies links to to.  When l is non-empty, to
+// must be an absolute http or https URL with a fixed host; anything else
+// (schemeless, relative, or with %s in the host) could end up somewhere the
+// list would deny, so it is rejected.
+func (l DomainList) Allow(to string) error {
+	if len(l) == 0 {
+		return nil
+	}
+	to = strings.TrimSpace(to)
+	// Escape %s so it parses, but survives into the host if it was there.
+	u, err := url.Parse(strings.ReplaceAll(to, "%s", "%25s"))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return fmt.Errorf("links must be absolute http or https URLs, not %q", to)
+	}
+	if strings.Contains(u.Host, "%") {
+		return fmt.Errorf("links may not use %%s in the host (%s)", to)
+	}
+	if l.Match(u.Hostname()) {
+		return fmt.Errorf("links to %s are not allowed", u.Hostname())
+	}
+	return nil
+}
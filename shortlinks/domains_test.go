@@ -0,0 +1,70 @@
+package shortlinks
+
+import "testing"
+
+func TestDomainListMatch(t *testing.T) {
+	l := ParseDomainList(" Example.com, ,docs.foo.org.,")
+	if len(l) != 2 {
+		t.Fatalf("expected 2 domains, got %q", l)
+	}
+
+	cases := []struct {
+		to    string
+		match bool
+	}{
+		{to: "https://example.com", match: true},
+		{to: "https://EXAMPLE.com/foo", match: true},
+		{to: "https://www.example.com/%s", match: true},
+		{to: "https://example.com.evil.net/", match: false},
+		{to: "https://notexample.com/", match: false},
+		{to: "https://docs.foo.org/x?q=%s", match: true},
+		{to: "https://foo.org/", match: false},
+		{to: "/relative", match: false},
+		{to: "", match: false},
+	}
+
+	for _, c := range cases {
+		if m := l.Match(destinationHost(c.to)); m != c.match {
+			t.Errorf("Match(%q) was %t, expected %t", c.to, m, c.match)
+		}
+	}
+}
+
+func TestDomainListAllow(t *testing.T) {
+	l := ParseDomainList("evil.com")
+
+	cases := []struct {
+		to    string
+		allow bool
+	}{
+		{to: "https://good.com/", allow: true},
+		{to: "http://good.com/%s", allow: true},
+		{to: "https://good.com/search?q=%s", allow: true},
+		{to: " https://good.com/ ", allow: true},
+		{to: "https://evil.com/", allow: false},
+		{to: "https://www.evil.com/", allow: false},
+		{to: " https://evil.com/", allow: false},
+		{to: "https:evil.com", allow: false},
+		{to: "https:/evil.com", allow: false},
+		{to: `https:\\evil.com`, allow: false},
+		{to: `https://good.com\.evil.com/`, allow: false},
+		{to: "evil.com", allow: false},
+		{to: "//evil.com/", allow: false},
+		{to: "/relative", allow: false},
+		{to: "javascript:alert(1)", allow: false},
+		{to: "https://%s/", allow: false},
+		{to: "https://%s.good.com/", allow: false},
+		{to: "https://good.com%s/", allow: false},
+		{to: "", allow: false},
+	}
+
+	for _, c := range cases {
+		if err := l.Allow(c.to); (err == nil) != c.allow {
+			t.Errorf("Allow(%q) returned %v, expected allowed to be %t", c.to, err, c.allow)
+		}
+	}
+
+	if err := DomainList(nil).Allow("/relative"); err != nil {
+		t.Errorf("empty list should allow anything: %s", err)
+	}
+}
@@ -0,0 +1,252 @@
+package shortlinks
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Dump is everything in a DB, for backups and bulk changes.  See Export,
+// WriteDump and ReadDump.
+type Dump struct {
+	Shortlinks []DumpedShortlink `json:"shortlinks" yaml:"shortlinks"`
+
+	// Warnings are problems found while reading a dump in one of the
+	// ForeignFormats.
+	Warnings []string `json:"-" yaml:"-"`
+}
+
+type DumpedShortlink struct {
+	From        string `json:"from" yaml:"from"`
+	To          string `json:"to" yaml:"to"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	Deleted     bool   `json:"deleted,omitempty" yaml:"deleted,omitempty"`
+
+	Tags []string `json:"tags,omitempty" yaml:"tags,omitempty"`
+
+	History []DumpedHistory `json:"history,omitempty" yaml:"history,omitempty"`
+}
+
+// Shortlink is d without its history, which CreatedAt, CreatedBy, UpdatedAt
+// and UpdatedBy are filled in from if it has any.
+func (d DumpedShortlink) Shortlink() Shortlink {
+	sl := Shortlink{From: d.From, To: d.To, Description: d.Description, Tags: d.Tags}
+	if len(d.History) == 0 {
+		return sl
+	}
+
+	first, last := d.History[0], d.History[len(d.History)-1]
+	// Unparseable times are left zero.
+	sl.CreatedAt, _ = ParseWhen(first.When)
+	sl.UpdatedAt, _ = ParseWhen(last.When)
+	sl.CreatedBy, sl.UpdatedBy = first.Who, last.Who
+	return sl
+}
+
+// DumpedHistory is a History without the From, which is implied by the
+// DumpedShortlink it's in.
+type DumpedHistory struct {
+	To          string `json:"to" yaml:"to"`
+	When        string `json:"when" yaml:"when"`
+	Who         string `json:"who,omitempty" yaml:"who,omitempty"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	Method      string `json:"method,omitempty" yaml:"method,omitempty"`
+
+	Tags []string `json:"tags,omitempty" yaml:"tags,omitempty"`
+}
+
+// Export dumps all shortlinks in db, including deleted ones if db is a
+// DBDeleted, along with their history.
+func Export(db DB) (Dump, error) {
+	var d Dump
+
+	live, err := db.AllShortlinks()
+	if err != nil {
+		return d, err
+	}
+	var deleted []Shortlink
+	if dbd, ok := As[DBDeleted](db); ok {
+		deleted, err = dbd.DeletedShortlinks()
+		if err != nil {
+			return d, err
+		}
+	}
+
+	add := func(sl Shortlink, deleted bool) error {
+		hs, err := db.History(sl.From)
+		if err != nil {
+			return err
+		}
+		ds := DumpedShortlink{From: sl.From, To: sl.To, Description: sl.Description, Deleted: deleted, Tags: sl.Tags}
+		for _, h := range hs {
+			ds.History = append(ds.History, DumpedHistory{
+				To:          h.To,
+				When:        FormatWhen(h.When),
+				Who:         h.Who,
+				Description: h.Description,
+				Method:      h.Method,
+				Tags:        h.Tags,
+			})
+		}
+		d.Shortlinks = append(d.Shortlinks, ds)
+		return nil
+	}
+	for _, sl := range live {
+		if err := add(sl, false); err != nil {
+			return d, err
+		}
+	}
+	for _, sl := range deleted {
+		if err := add(sl, true); err != nil {
+			return d, err
+		}
+	}
+
+	return d, nil
+}
+
+// DumpFormats are the formats WriteDump and ReadDump support.
+var DumpFormats = []string{"json", "csv", "yaml"}
+
+// DumpFormat guesses the format of a dump from its filename.
+func DumpFormat(filename string) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		return "csv"
+	case ".html", ".htm":
+		return "bookmarks"
+	case ".yaml", ".yml":
+		return "yaml"
+	default:
+		return "json"
+	}
+}
+
+// csvHeader is the header of CSV dumps.  Each shortlink is a row with a type
+// of "shortlink", followed by a row with a type of "history" for each
+// history entry.  Tags are space separated.
+var csvHeader = []string{"type", "from", "to", "description", "deleted", "when", "who", "method", "tags"}
+
+// csvHeaderV1 is csvHeader from before tags, which ReadDump still reads.
+var csvHeaderV1 = csvHeader[:8]
+
+// WriteDump writes d to w in format, which is one of DumpFormats.
+func WriteDump(w io.Writer, d Dump, format string) error {
+	switch format {
+	case "json":
+		e := json.NewEncoder(w)
+		e.SetIndent("", "  ")
+		return e.Encode(d)
+	case "yaml":
+		e := yaml.NewEncoder(w)
+		e.SetIndent(2)
+		if err := e.Encode(d); err != nil {
+			return err
+		}
+		return e.Close()
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write(csvHeader)
+		for _, sl := range d.Shortlinks {
+			cw.Write([]string{"shortlink", sl.From, sl.To, sl.Description, strconv.FormatBool(sl.Deleted), "", "", "", strings.Join(sl.Tags, " ")})
+			for _, h := range sl.History {
+				cw.Write([]string{"history", sl.From, h.To, h.Description, "", h.When, h.Who, h.Method, strings.Join(h.Tags, " ")})
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	default:
+		return fmt.Errorf("unknown format %q", format)
+	}
+}
+
+// ReadDump reads a dump in format, which is one of ImportFormats, from r.
+func ReadDump(r io.Reader, format string) (Dump, error) {
+	var d Dump
+
+	switch format {
+	case "json":
+		if err := json.NewDecoder(r).Decode(&d); err != nil {
+			return d, fmt.Errorf("couldn't parse json: %w", err)
+		}
+	case "yaml":
+		if err := yaml.NewDecoder(r).Decode(&d); err != nil && err != io.EOF {
+			return d, fmt.Errorf("couldn't parse yaml: %w", err)
+		}
+	case "csv":
+		rows, err := csv.NewReader(r).ReadAll()
+		if err != nil {
+			return d, fmt.Errorf("couldn't parse csv: %w", err)
+		}
+		if len(rows) == 0 {
+			return d, nil
+		}
+		header := strings.Join(rows[0], ",")
+		if header != strings.Join(csvHeader, ",") && header != strings.Join(csvHeaderV1, ",") {
+			return d, fmt.Errorf("csv header must be %s", strings.Join(csvHeader, ","))
+		}
+		tags := func(row []string) []string {
+			if len(row) < len(csvHeader) || row[8] == "" {
+				return nil
+			}
+			return strings.Fields(row[8])
+		}
+		for i, row := range rows[1:] {
+			switch row[0] {
+			case "shortlink":
+				d.Shortlinks = append(d.Shortlinks, DumpedShortlink{
+					From:        row[1],
+					To:          row[2],
+					Description: row[3],
+					Deleted:     row[4] == "true",
+					Tags:        tags(row),
+				})
+			case "history":
+				if len(d.Shortlinks) == 0 || d.Shortlinks[len(d.Shortlinks)-1].From != row[1] {
+					return d, fmt.Errorf("csv line %d: history for %s must follow its shortlink", i+2, row[1])
+				}
+				sl := &d.Shortlinks[len(d.Shortlinks)-1]
+				sl.History = append(sl.History, DumpedHistory{
+					To:          row[2],
+					Description: row[3],
+					When:        row[5],
+					Who:         row[6],
+					Method:      row[7],
+					Tags:        tags(row),
+				})
+			default:
+				return d, fmt.Errorf("csv line %d: unknown type %q", i+2, row[0])
+			}
+		}
+	case "golink":
+		return readGolink(r)
+	case "trotto":
+		return readTrotto(r)
+	case "golinks-csv":
+		return readGoLinksCSV(r)
+	case "bookmarks":
+		return readBookmarks(r)
+	default:
+		return d, fmt.Errorf("unknown format %q", format)
+	}
+
+	for i, sl := range d.Shortlinks {
+		if sl.From == "" {
+			return d, errors.New("every shortlink needs a from")
+		}
+		tags, err := NormalizeTags(sl.Tags)
+		if err != nil {
+			return d, fmt.Errorf("%s: %w", sl.From, err)
+		}
+		d.Shortlinks[i].Tags = tags
+	}
+
+	return d, nil
+}
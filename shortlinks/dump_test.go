@@ -0,0 +1,156 @@
+package shortlinks_test
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/frioux/shortlinks/shortlinks"
+	"github.com/frioux/shortlinks/storage/memstorage"
+)
+
+func seed() *memstorage.Client {
+	db := memstorage.New()
+	for _, sl := range []shortlinks.Shortlink{
+		{From: "a", To: "https://a.com", Description: "A, with a comma"},
+		{From: "b", To: "https://b.com/%s", Tags: []string{"eng", "ops"}},
+		{From: "c", To: "https://c.com"},
+	} {
+		db.InsertHistory(shortlinks.History{From: sl.From, To: sl.To, Who: "frew", Method: "test", Description: sl.Description, Tags: sl.Tags})
+		db.CreateShortlink(sl)
+	}
+	db.DeleteShortlink("c", "frew", "test")
+	return db
+}
+
+func TestDumpRoundTrip(t *testing.T) {
+	d, err := shortlinks.Export(seed())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Shortlinks) != 3 || !d.Shortlinks[2].Deleted || len(d.Shortlinks[2].History) != 2 {
+		t.Fatalf("unexpected dump: %+v", d)
+	}
+
+	for _, f := range shortlinks.DumpFormats {
+		var buf bytes.Buffer
+		if err := shortlinks.WriteDump(&buf, d, f); err != nil {
+			t.Fatalf("%s: %s", f, err)
+		}
+		got, err := shortlinks.ReadDump(&buf, f)
+		if err != nil {
+			t.Fatalf("%s: %s", f, err)
+		}
+		if !reflect.DeepEqual(got, d) {
+			t.Errorf("%s: round trip changed dump\ngot:      %+v\nexpected: %+v", f, got, d)
+		}
+	}
+}
+
+func TestImportModes(t *testing.T) {
+	d := shortlinks.Dump{Shortlinks: []shortlinks.DumpedShortlink{
+		{From: "a", To: "https://a.org"},
+		{From: "c", To: "https://c.com"},
+		{From: "d", To: "https://d.com"},
+	}}
+
+	for mode, expected := range map[shortlinks.ImportMode]map[shortlinks.ImportAction]int{
+		shortlinks.ImportMerge:        {shortlinks.ActionUpdate: 1, shortlinks.ActionCreate: 2},
+		shortlinks.ImportSkipExisting: {shortlinks.ActionSkip: 1, shortlinks.ActionCreate: 2},
+		shortlinks.ImportReplace:      {shortlinks.ActionUpdate: 1, shortlinks.ActionCreate: 2, shortlinks.ActionDelete: 1},
+	} {
+		db := seed()
+		changes, err := shortlinks.PlanImport(db, d, mode, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := shortlinks.ImportSummary(changes); !reflect.DeepEqual(got, expected) {
+			t.Errorf("%s: expected %v, got %v", mode, expected, got)
+		}
+
+		if err := shortlinks.ApplyImport(db, changes, "alice", "import"); err != nil {
+			t.Fatal(err)
+		}
+		if sl, _ := db.Shortlink("d"); sl.To != "https://d.com" {
+			t.Errorf("%s: expected d to be created, got %+v", mode, sl)
+		}
+		sl, _ := db.Shortlink("a")
+		if (mode == shortlinks.ImportSkipExisting) != (sl.To == "https://a.com") {
+			t.Errorf("%s: unexpected a: %+v", mode, sl)
+		}
+		sl, _ = db.Shortlink("b")
+		if (mode == shortlinks.ImportReplace) != (sl.From == "") {
+			t.Errorf("%s: unexpected b: %+v", mode, sl)
+		}
+		if h, _ := db.History("d"); len(h) != 1 || h[0].Who != "alice" || h[0].Method != "import" {
+			t.Errorf("%s: unexpected history: %+v", mode, h)
+		}
+	}
+
+	d.Shortlinks = append(d.Shortlinks, shortlinks.DumpedShortlink{From: "a"})
+	if _, err := shortlinks.PlanImport(seed(), d, shortlinks.ImportMerge, nil); err == nil {
+		t.Error("expected duplicate shortlinks to be an error")
+	}
+
+	d = shortlinks.Dump{Shortlinks: []shortlinks.DumpedShortlink{{From: "short", To: "https://bit.ly/x"}}}
+	if _, err := shortlinks.PlanImport(seed(), d, shortlinks.ImportMerge, shortlinks.ParseDomainList("bit.ly")); err == nil || !strings.Contains(err.Error(), "short") {
+		t.Errorf("expected importing a denied destination to be an error naming it, got %v", err)
+	}
+}
+
+func TestRestore(t *testing.T) {
+	d, err := shortlinks.Export(seed())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := memstorage.New()
+	changes, err := shortlinks.PlanImport(db, d, shortlinks.ImportMerge, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := shortlinks.ApplyImport(db, changes, "alice", "import"); err != nil {
+		t.Fatal(err)
+	}
+
+	if del, _ := db.DeletedShortlinks(); len(del) != 1 || del[0].From != "c" {
+		t.Errorf("expected c to be restored as deleted, got %+v", del)
+	}
+	h, _ := db.History("a")
+	if len(h) != 2 || h[0].Who != "frew" || shortlinks.FormatWhen(h[0].When) != d.Shortlinks[0].History[0].When || h[1].Who != "alice" {
+		t.Errorf("expected history to be restored and the import recorded, got %+v", h)
+	}
+	if h, _ := db.History("c"); len(h) != 2 {
+		t.Errorf("expected history of deleted shortlink to be restored, got %+v", h)
+	}
+
+	// Importing the same dump again changes nothing.
+	changes, err = shortlinks.PlanImport(db, d, shortlinks.ImportMerge, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := shortlinks.ImportSummary(changes); !reflect.DeepEqual(got, map[shortlinks.ImportAction]int{shortlinks.ActionUnchanged: 3}) {
+		t.Errorf("expected nothing to change, got %v", got)
+	}
+}
+
+func TestReadDumpCSVWithoutTags(t *testing.T) {
+	d, err := shortlinks.ReadDump(strings.NewReader(
+		"type,from,to,description,deleted,when,who,method\n"+
+			"shortlink,a,https://a.com,A,false,,,\n"+
+			"history,a,https://a.com,A,,2019-04-01 12:30:00,frew,test\n"), "csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Shortlinks) != 1 || d.Shortlinks[0].Tags != nil || len(d.Shortlinks[0].History) != 1 {
+		t.Errorf("unexpected dump: %+v", d)
+	}
+}
+
+func TestReadDumpInvalidTags(t *testing.T) {
+	_, err := shortlinks.ReadDump(strings.NewReader(`{"shortlinks":[{"from":"a","to":"https://a.com","tags":["no/slashes"]}]}`), "json")
+	if err == nil || !strings.Contains(err.Error(), "invalid tag") {
+		t.Errorf("expected invalid tag error, got %v", err)
+	}
+}
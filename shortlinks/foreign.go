@@ -0,0 +1,310 @@
+package shortlinks
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// ForeignFormats are formats from other go link services and browsers that
+// ReadDump can import from, but WriteDump can't write:
+//
+//   - golink is the newline delimited JSON from Tailscale's golink, as
+//     served at /.export or stored in its snapshot file.
+//   - trotto is a JSON array of links as exported by Trotto.
+//   - golinks-csv is a CSV with a header row, as exported by GoLinks and
+//     similar services.  Columns are found by name, like name or keyword
+//     and url or destination.
+//   - bookmarks is a Netscape bookmark file, as exported by every browser.
+//     Bookmarks with a keyword use it as the shortlink; others use their
+//     title.  Firefox's bookmark tags are kept.
+//
+// Placeholders like golink's {{.Path}} are converted to %s.  Anything that
+// can't be converted is left alone and noted in Dump.Warnings.
+var ForeignFormats = []string{"golink", "trotto", "golinks-csv", "bookmarks"}
+
+// ImportFormats are all the formats ReadDump understands.
+var ImportFormats = append(append([]string{}, DumpFormats...), ForeignFormats...)
+
+// foreign maps the foreign link at from to to, cleaning up both and
+// noting anything surprising in d.Warnings.  Links that already exist in d
+// or that can't be shortlinks are skipped.
+func (d *Dump) foreign(from, to, description string, tags []string, h *DumpedHistory) {
+	from = strings.Trim(strings.TrimSpace(from), "/")
+	to = strings.TrimSpace(to)
+
+	if from == "" || to == "" {
+		d.warn("skipped link with no name or destination (%q → %q)", from, to)
+		return
+	}
+	if strings.Contains(from, "/") {
+		d.warn("skipped %s: shortlinks can't contain /", from)
+		return
+	}
+	for _, sl := range d.Shortlinks {
+		if sl.From == from {
+			d.warn("skipped %s → %s: already imported as %s → %s", from, to, sl.From, sl.To)
+			return
+		}
+	}
+
+	var valid []string
+	for _, t := range tags {
+		if nt, err := NormalizeTags([]string{t}); err != nil {
+			d.warn("%s: dropped %s", from, err)
+		} else {
+			valid = append(valid, nt...)
+		}
+	}
+	valid, _ = NormalizeTags(valid)
+
+	ds := DumpedShortlink{From: from, To: to, Description: description, Tags: valid}
+	if h != nil {
+		h.To = to
+		h.Description = description
+		h.Tags = valid
+		ds.History = []DumpedHistory{*h}
+	}
+	d.Shortlinks = append(d.Shortlinks, ds)
+}
+
+func (d *Dump) warn(format string, args ...interface{}) {
+	d.Warnings = append(d.Warnings, fmt.Sprintf(format, args...))
+}
+
+// placeholder converts a foreign placeholder in to to %s, using the
+// patterns in res.  If there's more than one placeholder only the first is
+// converted, since shortlinks only support one.
+func (d *Dump) placeholder(from, to string, res ...*regexp.Regexp) string {
+	var converted bool
+	for _, re := range res {
+		to = re.ReplaceAllStringFunc(to, func(m string) string {
+			if converted {
+				d.warn("%s: couldn't convert %s, only one placeholder is supported", from, m)
+				return m
+			}
+			converted = true
+			return "%s"
+		})
+	}
+	return to
+}
+
+var (
+	golinkPath  = regexp.MustCompile(`{{\s*((Query|Path)Escape\s+)?\.Path\s*}}`)
+	golinkOther = regexp.MustCompile(`{{.*?}}`)
+)
+
+func readGolink(r io.Reader) (Dump, error) {
+	var d Dump
+
+	type link struct {
+		Short, Long, Owner string
+		Created, LastEdit  time.Time
+	}
+
+	var links []link
+	br := bufio.NewReader(r)
+	if b, err := br.Peek(1); err == nil && b[0] == '[' {
+		if err := json.NewDecoder(br).Decode(&links); err != nil {
+			return d, fmt.Errorf("couldn't parse golink json: %w", err)
+		}
+	} else {
+		dec := json.NewDecoder(br)
+		for dec.More() {
+			var l link
+			if err := dec.Decode(&l); err != nil {
+				return d, fmt.Errorf("couldn't parse golink json: %w", err)
+			}
+			links = append(links, l)
+		}
+	}
+
+	for _, l := range links {
+		to := d.placeholder(l.Short, l.Long, golinkPath)
+		for _, m := range golinkOther.FindAllString(to, -1) {
+			d.warn("%s: couldn't convert %s", l.Short, m)
+		}
+
+		when := l.LastEdit
+		if when.IsZero() {
+			when = l.Created
+		}
+		var h *DumpedHistory
+		if !when.IsZero() {
+			h = &DumpedHistory{When: when.UTC().Format(time.RFC3339Nano), Who: l.Owner, Method: "golink"}
+		}
+		d.foreign(l.Short, to, "", nil, h)
+	}
+
+	return d, nil
+}
+
+// trottoPlaceholder is the same as ours, but Trotto allows more than one.
+var trottoPlaceholder = regexp.MustCompile(`%s`)
+
+func readTrotto(r io.Reader) (Dump, error) {
+	var d Dump
+
+	var links []struct {
+		Shortpath      string `json:"shortpath"`
+		DestinationURL string `json:"destination_url"`
+		Owner          string `json:"owner"`
+		Created        string `json:"created"`
+	}
+	if err := json.NewDecoder(r).Decode(&links); err != nil {
+		return d, fmt.Errorf("couldn't parse trotto json: %w", err)
+	}
+
+	for _, l := range links {
+		// Trotto puts placeholders in the shortpath too, eg foo/%s.
+		from := trottoPlaceholder.ReplaceAllString(l.Shortpath, "")
+		to := d.placeholder(from, l.DestinationURL, trottoPlaceholder)
+
+		var h *DumpedHistory
+		if _, err := ParseWhen(l.Created); err == nil {
+			h = &DumpedHistory{When: l.Created, Who: l.Owner, Method: "trotto"}
+		}
+		d.foreign(from, to, "", nil, h)
+	}
+
+	return d, nil
+}
+
+// golinksPlaceholder matches GoLinks style placeholders like {*} and {1}.
+var golinksPlaceholder = regexp.MustCompile(`{(\*|\d+)}`)
+
+// csvColumns are the names of columns that readGoLinksCSV looks for, in
+// order of preference.
+var csvColumns = map[string][]string{
+	"from":        {"name", "keyword", "shortlink", "short", "golink", "alias", "shortpath", "link name"},
+	"to":          {"url", "destination", "destination_url", "destination url", "long", "target", "link"},
+	"description": {"description", "desc", "notes", "title"},
+	"owner":       {"owner", "created by", "creator", "author"},
+	"created":     {"created", "created at", "date created", "updated", "last updated"},
+	"tags":        {"tags", "tag", "labels", "categories"},
+}
+
+func readGoLinksCSV(r io.Reader) (Dump, error) {
+	var d Dump
+
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return d, fmt.Errorf("couldn't parse csv: %w", err)
+	}
+	if len(rows) == 0 {
+		return d, nil
+	}
+
+	cols := map[string]int{}
+	for field, names := range csvColumns {
+		cols[field] = -1
+	names:
+		for _, n := range names {
+			for i, h := range rows[0] {
+				if strings.EqualFold(strings.TrimSpace(h), n) {
+					cols[field] = i
+					break names
+				}
+			}
+		}
+	}
+	if cols["from"] == -1 || cols["to"] == -1 {
+		return d, fmt.Errorf("couldn't find name and url columns in csv header (%s)", strings.Join(rows[0], ","))
+	}
+
+	get := func(row []string, field string) string {
+		if i := cols[field]; i != -1 {
+			return row[i]
+		}
+		return ""
+	}
+	for _, row := range rows[1:] {
+		from := strings.TrimPrefix(get(row, "from"), "go/")
+		from = golinksPlaceholder.ReplaceAllString(from, "")
+		to := d.placeholder(from, get(row, "to"), golinksPlaceholder)
+
+		var h *DumpedHistory
+		if when, err := ParseWhen(get(row, "created")); err == nil {
+			h = &DumpedHistory{When: when.UTC().Format(time.RFC3339Nano), Who: get(row, "owner"), Method: "golinks"}
+		} else if owner := get(row, "owner"); owner != "" {
+			// Without a date, the import is as good a time as any.
+			h = &DumpedHistory{When: time.Now().UTC().Format(time.RFC3339Nano), Who: owner, Method: "golinks"}
+		}
+		d.foreign(from, to, get(row, "description"), strings.FieldsFunc(get(row, "tags"), tagSeparator), h)
+	}
+
+	return d, nil
+}
+
+// tagSeparator splits foreign lists of tags, which are usually comma or
+// semicolon separated.
+func tagSeparator(r rune) bool { return r == ',' || r == ';' || r == ' ' }
+
+var slugUnsafe = regexp.MustCompile(`[^a-z0-9]+`)
+
+func readBookmarks(r io.Reader) (Dump, error) {
+	var d Dump
+
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return d, err
+	}
+	if !bytes.Contains(bytes.ToUpper(b[:min(len(b), 1024)]), []byte("NETSCAPE-BOOKMARK-FILE")) {
+		return d, fmt.Errorf("not a netscape bookmark file")
+	}
+
+	z := html.NewTokenizer(bytes.NewReader(b))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			if z.Err() == io.EOF {
+				return d, nil
+			}
+			return d, z.Err()
+		case html.StartTagToken:
+			if name, _ := z.TagName(); string(name) != "a" {
+				continue
+			}
+
+			attrs := map[string]string{}
+			for {
+				k, v, more := z.TagAttr()
+				attrs[string(k)] = string(v)
+				if !more {
+					break
+				}
+			}
+			if !strings.HasPrefix(attrs["href"], "http:") && !strings.HasPrefix(attrs["href"], "https:") {
+				continue
+			}
+
+			var title string
+			if z.Next() == html.TextToken {
+				title = strings.TrimSpace(string(z.Text()))
+			}
+
+			from := attrs["shortcuturl"]
+			if from == "" {
+				from = strings.Trim(slugUnsafe.ReplaceAllString(strings.ToLower(title), "-"), "-")
+			}
+
+			var h *DumpedHistory
+			if added := attrs["add_date"]; added != "" {
+				var secs int64
+				if _, err := fmt.Sscan(added, &secs); err == nil {
+					h = &DumpedHistory{When: time.Unix(secs, 0).UTC().Format(time.RFC3339Nano), Method: "bookmarks"}
+				}
+			}
+			d.foreign(from, attrs["href"], title, strings.FieldsFunc(attrs["tags"], tagSeparator), h)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package shortlinks_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/frioux/shortlinks/shortlinks"
+	"github.com/frioux/shortlinks/storage/memstorage"
+)
+
+func readForeign(t *testing.T, format, in string) shortlinks.Dump {
+	t.Helper()
+
+	d, err := shortlinks.ReadDump(strings.NewReader(in), format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func tos(d shortlinks.Dump) map[string]string {
+	ret := map[string]string{}
+	for _, sl := range d.Shortlinks {
+		ret[sl.From] = sl.To
+	}
+	return ret
+}
+
+func TestGolink(t *testing.T) {
+	d := readForeign(t, "golink", `{"Short":"gh","Long":"https://github.com/{{.Path}}","Created":"2022-01-02T03:04:05Z","LastEdit":"2022-02-03T04:05:06Z","Owner":"frew@example.com"}
+{"Short":"q","Long":"https://search.example.com/?q={{QueryEscape .Path}}","Owner":"frew@example.com"}
+{"Short":"me","Long":"https://example.com/{{.User}}","Owner":"frew@example.com"}
+`)
+
+	expected := map[string]string{
+		"gh": "https://github.com/%s",
+		"q":  "https://search.example.com/?q=%s",
+		"me": "https://example.com/{{.User}}",
+	}
+	if got := tos(d); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+	if len(d.Warnings) != 1 || !strings.Contains(d.Warnings[0], "{{.User}}") {
+		t.Errorf("expected a warning about {{.User}}, got %v", d.Warnings)
+	}
+
+	h := d.Shortlinks[0].History
+	if len(h) != 1 || h[0].When != "2022-02-03T04:05:06Z" || h[0].Who != "frew@example.com" || h[0].Method != "golink" {
+		t.Errorf("unexpected history: %+v", h)
+	}
+}
+
+func TestTrotto(t *testing.T) {
+	d := readForeign(t, "trotto", `[
+		{"shortpath": "docs/%s", "destination_url": "https://docs.example.com/%s", "owner": "frew@example.com", "created": "2020-01-02 03:04:05"},
+		{"shortpath": "two/%s/%s", "destination_url": "https://example.com/%s/%s"},
+		{"shortpath": "team/wiki", "destination_url": "https://wiki.example.com"}
+	]`)
+
+	expected := map[string]string{"docs": "https://docs.example.com/%s", "two": "https://example.com/%s/%s"}
+	if got := tos(d); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+	if len(d.Warnings) != 2 {
+		t.Errorf("expected warnings about two and team/wiki, got %v", d.Warnings)
+	}
+}
+
+func TestGoLinksCSV(t *testing.T) {
+	d := readForeign(t, "golinks-csv", `Name,Destination URL,Description,Owner
+go/jira/{*},https://jira.example.com/browse/{*},Tickets,frew@example.com
+wiki,https://wiki.example.com,,
+Wiki,https://other.example.com,,
+`)
+
+	expected := map[string]string{"jira": "https://jira.example.com/browse/%s", "wiki": "https://wiki.example.com", "Wiki": "https://other.example.com"}
+	if got := tos(d); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+	if d.Shortlinks[0].Description != "Tickets" || d.Shortlinks[0].History[0].Who != "frew@example.com" {
+		t.Errorf("unexpected shortlink: %+v", d.Shortlinks[0])
+	}
+
+	if _, err := shortlinks.ReadDump(strings.NewReader("a,b\n1,2\n"), "golinks-csv"); err == nil {
+		t.Error("expected an error for a csv without recognizable columns")
+	}
+}
+
+func TestBookmarks(t *testing.T) {
+	d := readForeign(t, "bookmarks", `<!DOCTYPE NETSCAPE-Bookmark-file-1>
+<META HTTP-EQUIV="Content-Type" CONTENT="text/html; charset=UTF-8">
+<TITLE>Bookmarks</TITLE>
+<H1>Bookmarks</H1>
+<DL><p>
+    <DT><H3>Work</H3>
+    <DL><p>
+        <DT><A HREF="https://search.example.com/?q=%s" ADD_DATE="1600000000" SHORTCUTURL="s">Search</A>
+        <DT><A HREF="https://wiki.example.com/" ADD_DATE="1600000000">Team Wiki!</A>
+        <DT><A HREF="place:sort=8">Recent Tags</A>
+    </DL><p>
+</DL><p>
+`)
+
+	expected := map[string]string{"s": "https://search.example.com/?q=%s", "team-wiki": "https://wiki.example.com/"}
+	if got := tos(d); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+	if sl := d.Shortlinks[1]; sl.Description != "Team Wiki!" || sl.History[0].When != "2020-09-13T12:26:40Z" {
+		t.Errorf("unexpected shortlink: %+v", sl)
+	}
+}
+
+func TestForeignConflicts(t *testing.T) {
+	db := memstorage.New()
+	db.CreateShortlink(shortlinks.Shortlink{From: "gh", To: "https://gitlab.com/%s"})
+
+	d := readForeign(t, "golink", `{"Short":"gh","Long":"https://github.com/{{.Path}}"}`)
+	changes, err := shortlinks.PlanImport(db, d, shortlinks.ImportSkipExisting, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0].Action != shortlinks.ActionSkip || !changes[0].Conflict() {
+		t.Errorf("expected a skipped conflict, got %+v", changes)
+	}
+}
@@ -1,27 +1,29 @@
 package shortlinks
 
 import (
+	"fmt"
 	"net/http"
 )
 
-func deleteHandler(db DB, auth Auth) http.Handler {
+func deleteHandler(db DB, auth Auth, managed Managed) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == "POST" {
-			var u string
-			if auth != nil {
-				var err error
-				u, err = auth.User(r)
-				if err != nil {
-					_403(w, err)
-					return
-				}
+			u, m, err := authenticate(auth, r)
+			if err != nil {
+				_403(w, err)
+				return
 			}
 			if err := r.ParseForm(); err != nil {
 				_500(w, err)
 				return
 			}
 
-			if err := db.DeleteShortlink(r.Form.Get("from"), u); err != nil {
+			if from := r.Form.Get("from"); isManaged(managed, from) {
+				_403(w, fmt.Errorf("%s is managed elsewhere", from))
+				return
+			}
+
+			if err := db.DeleteShortlink(r.Form.Get("from"), u, m); err != nil {
 				_500(w, err)
 				return
 			}
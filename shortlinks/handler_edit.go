@@ -1,12 +1,18 @@
 package shortlinks
 
 import (
+	"fmt"
 	"net/http"
+	"strings"
 )
 
 type edit struct {
 	Shortlink
 	Submit string
+	CSRF   string
+
+	// Managed is set if the shortlink can't be edited here.
+	Managed bool
 
 	History []History
 }
@@ -19,19 +25,15 @@ func (e edit) Title() string {
 	return "Edit " + e.From
 }
 
-func editHandler(db DB, auth Auth) http.Handler {
+func editHandler(db DB, auth Auth, denied DomainList, managed Managed) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		from := r.URL.Query().Get("from")
 
 		if r.Method == "POST" {
-			var u string
-			if auth != nil {
-				var err error
-				u, err = auth.User(r)
-				if err != nil {
-					_403(w, err)
-					return
-				}
+			u, m, err := authenticate(auth, r)
+			if err != nil {
+				_403(w, err)
+				return
 			}
 			if err := r.ParseForm(); err != nil {
 				_500(w, err)
@@ -42,22 +44,42 @@ func editHandler(db DB, auth Auth) http.Handler {
 				from = r.Form.Get("from")
 			}
 
+			if isManaged(managed, from) {
+				_403(w, fmt.Errorf("%s is managed elsewhere", from))
+				return
+			}
+
+			to := strings.TrimSpace(r.Form.Get("to"))
+			if err := denied.Allow(to); err != nil {
+				_400(w, err)
+				return
+			}
+
+			tags, err := ParseTags(r.Form.Get("tags"))
+			if err != nil {
+				_400(w, err)
+				return
+			}
+
 			if err := db.InsertHistory(History{
 				From: from,
-				To:   r.Form.Get("to"),
+				To:   to,
 				Who:  u,
 
+				Method:      m,
 				Description: r.Form.Get("description"),
+				Tags:        tags,
 			}); err != nil {
 				_500(w, err)
 				return
 			}
 			if err := db.CreateShortlink(Shortlink{
-				To:   r.Form.Get("to"),
+				To:   to,
 				From: from,
 
 				Description: r.Form.Get("description"),
-			}); err != nil {
+				Tags:        tags,
+			}.touched(u)); err != nil {
 				_500(w, err)
 				return
 			}
@@ -83,6 +105,9 @@ func editHandler(db DB, auth Auth) http.Handler {
 			History:   h,
 
 			Submit: "Update",
+			CSRF:   csrfToken(r),
+
+			Managed: isManaged(managed, from),
 		}
 
 		if err := tpl.ExecuteTemplate(w, "edit.html", v); err != nil {
@@ -0,0 +1,39 @@
+package shortlinks
+
+import (
+	"fmt"
+	"net/http"
+)
+
+var dumpContentTypes = map[string]string{
+	"json": "application/json",
+	"csv":  "text/csv",
+	"yaml": "application/yaml",
+}
+
+func exportHandler(db DB) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = "json"
+		}
+		ct, ok := dumpContentTypes[format]
+		if !ok {
+			_400(w, fmt.Errorf("unknown format %q", format))
+			return
+		}
+
+		d, err := Export(db)
+		if err != nil {
+			_500(w, err)
+			return
+		}
+
+		w.Header().Add("Content-Type", ct)
+		w.Header().Add("Content-Disposition", `attachment; filename="shortlinks.`+format+`"`)
+		if err := WriteDump(w, d, format); err != nil {
+			_500(w, err)
+			return
+		}
+	})
+}
@@ -0,0 +1,121 @@
+package shortlinks
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+type importView struct {
+	CSRF string
+
+	Formats, ExportFormats []string
+
+	Format string
+	Mode   ImportMode
+	Data   string
+
+	// Changes is set when previewing an import.
+	Changes   []ImportChange
+	Summary   map[ImportAction]int
+	Conflicts int
+	Warnings  []string
+}
+
+func (i importView) Title() string { return "import" }
+
+func importHandler(db DB, auth Auth, denied DomainList, managed Managed) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v := importView{
+			CSRF: csrfToken(r),
+
+			Formats:       ImportFormats,
+			ExportFormats: DumpFormats,
+
+			Format: "json",
+			Mode:   ImportMerge,
+		}
+
+		if r.Method == "POST" {
+			u, m, err := authenticate(auth, r)
+			if err != nil {
+				_403(w, err)
+				return
+			}
+			if err := r.ParseMultipartForm(32 << 20); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+				_400(w, err)
+				return
+			}
+
+			v.Mode, err = ParseImportMode(r.Form.Get("mode"))
+			if err != nil {
+				_400(w, err)
+				return
+			}
+			v.Format = r.Form.Get("format")
+			v.Data = r.Form.Get("data")
+			if f, fh, err := r.FormFile("file"); err == nil {
+				b, err := io.ReadAll(f)
+				f.Close()
+				if err != nil {
+					_400(w, err)
+					return
+				}
+				v.Data = string(b)
+				if v.Format == "" {
+					v.Format = DumpFormat(fh.Filename)
+				}
+			}
+			if v.Format == "" {
+				v.Format = "json"
+			}
+
+			d, err := ReadDump(strings.NewReader(v.Data), v.Format)
+			if err != nil {
+				_400(w, err)
+				return
+			}
+
+			changes, err := PlanImport(db, d, v.Mode, denied)
+			if err != nil {
+				_400(w, err)
+				return
+			}
+			for _, c := range changes {
+				if c.Action == ActionUnchanged || c.Action == ActionSkip {
+					continue
+				}
+				if from := importFrom(c); isManaged(managed, from) {
+					_400(w, fmt.Errorf("%s is managed elsewhere", from))
+					return
+				}
+			}
+
+			if r.Form.Get("confirm") == "" {
+				v.Changes = changes
+				v.Summary = ImportSummary(changes)
+				v.Warnings = d.Warnings
+				for _, c := range changes {
+					if c.Conflict() {
+						v.Conflicts++
+					}
+				}
+			} else {
+				if err := ApplyImport(db, changes, u, m); err != nil {
+					_500(w, err)
+					return
+				}
+				w.Header().Add("Location", "/")
+				w.WriteHeader(303)
+				return
+			}
+		}
+
+		if err := tpl.ExecuteTemplate(w, "import.html", v); err != nil {
+			_500(w, err)
+			return
+		}
+	})
+}
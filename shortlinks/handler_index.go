@@ -1,7 +1,9 @@
 package shortlinks
 
 import (
+	"fmt"
 	"net/http"
+	"os"
 	"sort"
 	"strings"
 
@@ -10,34 +12,78 @@ import (
 
 type index struct {
 	Shortlinks []Shortlink
+	CSRF       string
+
+	// Managed are the shortlinks that can't be edited here.
+	Managed map[string]bool
+
+	// Tag, if set, is the tag Shortlinks are filtered by.
+	Tag string
+
+	// TagBase is prepended to tags to link to them.
+	TagBase string
+
+	// Public hides options that only make sense on the read-write server.
+	Public bool
+
+	Options listOptions
+	Next    string
+}
+
+// newIndex loads a page of the index.
+func newIndex(db PublicDB, o listOptions, tagBase string) (index, error) {
+	p, err := listShortlinks(db, o)
+	if err != nil {
+		return index{}, err
+	}
+
+	return index{Shortlinks: p.Shortlinks, Tag: o.Tag, TagBase: tagBase, Options: o, Next: p.Next}, nil
+}
+
+// SortURL links to the first page of the index sorted by sort.
+func (i index) SortURL(sort ListSort) string {
+	o := i.Options
+	o.Sort = sort
+	return "?" + o.query("")
+}
+
+// NextURL links to the next page of the index, if there is one.
+func (i index) NextURL() string {
+	if i.Next == "" {
+		return ""
+	}
+	return "?" + i.Options.query(i.Next)
 }
 
 type search struct {
 	Path       string
 	Shortlinks []Shortlink
+	CSRF       string
 }
 
-func (i index) Title() string       { return "go links" }
+func (i index) Title() string {
+	if i.Tag != "" {
+		return "go links tagged " + i.Tag
+	}
+	return "go links"
+}
 func (i index) To() string          { return "" }
 func (i index) From() string        { return "" }
 func (i index) Submit() string      { return "Create" }
 func (i index) Description() string { return "" }
+func (i index) Tags() []string      { return nil }
 
 func (s search) Title() string       { return "go links" }
 func (s search) To() string          { return "" }
 func (s search) From() string        { return "" }
 func (s search) Submit() string      { return "Create" }
 func (s search) Description() string { return "" }
+func (s search) Tags() []string      { return nil }
 
 type scoredShortlink struct {
 	shortlink Shortlink
-	score     int
+	score     float64
 }
-type scoredShortLinksWrapper []scoredShortlink
-
-func (s scoredShortLinksWrapper) Len() int           { return len(s) }
-func (s scoredShortLinksWrapper) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
-func (s scoredShortLinksWrapper) Less(i, j int) bool { return s[i].score < s[j].score }
 
 func min(a, b int) int {
 	if a < b {
@@ -46,21 +92,129 @@ func min(a, b int) int {
 		return b
 	}
 }
-func possibleMatches(shortlinks []Shortlink, path string, resultSize int) []Shortlink {
-	scoredShortlinks := make([]scoredShortlink, len(shortlinks))
 
-	for i, sl := range shortlinks {
-		score := edlib.DamerauLevenshteinDistance(path, sl.From)
-		scoredShortlinks[i] = scoredShortlink{shortlink: sl, score: score}
+const (
+	// suggestionThreshold is the relevance below which possibleMatches
+	// doesn't suggest a shortlink.
+	suggestionThreshold = 0.4
+
+	// autoRedirectThreshold is the similarity above which a lone
+	// suggestion is close enough to redirect to.
+	autoRedirectThreshold = 0.75
+)
+
+// similarity is how alike path and from are, from 0 to 1, as edit distance
+// relative to the longer of the two, so that a typo in a long name counts for
+// less than in a short one.
+func similarity(path, from string) float64 {
+	l := max(len(path), len(from))
+	if l == 0 {
+		return 1
+	}
+	return 1 - float64(edlib.DamerauLevenshteinDistance(path, from))/float64(l)
+}
+
+// relevance scores how likely it is that someone going to path meant sl.
+// It's based on similarity, boosted for prefix and substring matches, for
+// descriptions mentioning path and for popular shortlinks, with popularity
+// the share of hits that sl has had out of the most any shortlink has had.
+func relevance(sl Shortlink, path string, popularity float64) float64 {
+	path, from := strings.ToLower(path), strings.ToLower(sl.From)
+
+	score := similarity(path, from)
+	switch {
+	case path == "":
+	case strings.HasPrefix(from, path) || strings.HasPrefix(path, from):
+		score += 0.3
+	case strings.Contains(from, path) || strings.Contains(path, from):
+		score += 0.2
 	}
 
-	sort.Sort(scoredShortLinksWrapper(scoredShortlinks))
+	// A word of the description starting with a word of path is enough to
+	// be suggested on its own.
+description:
+	for _, t := range searchTerms(path) {
+		if len(t) < 3 {
+			continue
+		}
+		for _, w := range searchTerms(sl.Description) {
+			if strings.HasPrefix(w, t) {
+				score += suggestionThreshold
+				break description
+			}
+		}
+	}
 
-	for i, sl := range scoredShortlinks {
-		shortlinks[i] = sl.shortlink
+	return score + 0.1*popularity
+}
+
+// possibleMatches returns up to resultSize shortlinks that path might have
+// meant, best first, leaving out anything below suggestionThreshold.
+func possibleMatches(shortlinks []Shortlink, path string, resultSize int, pop popularity) []scoredShortlink {
+	var scored []scoredShortlink
+	for _, sl := range shortlinks {
+		if score := relevance(sl, path, pop[sl.From]); score >= suggestionThreshold {
+			scored = append(scored, scoredShortlink{shortlink: sl, score: score})
+		}
 	}
 
-	return shortlinks[:min(resultSize, len(shortlinks))]
+	sort.SliceStable(scored, func(i, j int) bool { return scored[i].score > scored[j].score })
+
+	return scored[:min(resultSize, len(scored))]
+}
+
+// autoRedirect returns the one match that's close enough to path to redirect
+// to without asking, if there is exactly one.
+func autoRedirect(matches []scoredShortlink, path string) (Shortlink, bool) {
+	var ret Shortlink
+	var found int
+	for _, m := range matches {
+		if similarity(strings.ToLower(path), strings.ToLower(m.shortlink.From)) >= autoRedirectThreshold {
+			ret = m.shortlink
+			found++
+		}
+	}
+	return ret, found == 1
+}
+
+// addHit counts a redirect to from, if db counts hits; see DBHits.  A
+// redirect shouldn't fail because it couldn't be counted, so errors are only
+// logged.
+func addHit(db PublicDB, from string) {
+	h, ok := As[DBHits](db)
+	if !ok {
+		return
+	}
+	if err := h.AddHits(from, 1); err != nil {
+		fmt.Fprintln(os.Stderr, "couldn't count hit:", err)
+	}
+}
+
+// popularity is the hits of each shortlink relative to the most any shortlink
+// has had, from 0 to 1.  A nil popularity ranks every shortlink the same.
+type popularity map[string]float64
+
+// loadPopularity loads the popularity of every shortlink from db, or returns
+// nil if db doesn't count hits.
+func loadPopularity(db PublicDB) (popularity, error) {
+	h, ok := As[DBHits](db)
+	if !ok {
+		return nil, nil
+	}
+	hits, err := h.Hits()
+	if err != nil {
+		return nil, err
+	}
+
+	var most int
+	for _, n := range hits {
+		most = max(most, n)
+	}
+	p := make(popularity, len(hits))
+	for from, n := range hits {
+		p[from] = float64(n) / float64(most)
+	}
+	return p, nil
 }
 
 // split splits the path string into the path to query the database with and the string subsitution value
@@ -81,15 +235,30 @@ func substitute(shortlink Shortlink, substitution string) string {
 	return strings.Replace(shortlink.To, "%s", substitution, 1)
 }
 
-func indexHandler(db PublicDB) http.Handler {
+func indexHandler(db PublicDB, managed Managed, autoRedirects bool) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path == "/" {
-			sl, err := db.AllShortlinks()
+			o, err := parseListOptions(r.URL.Query())
 			if err != nil {
+				_400(w, err)
+				return
+			}
+			v, err := newIndex(db, o, "/_tags/")
+			if err != nil {
+				if badListOptions(err) {
+					_400(w, err)
+					return
+				}
 				_500(w, err)
 				return
 			}
-			v := index{Shortlinks: sl}
+			v.CSRF = csrfToken(r)
+			v.Managed = map[string]bool{}
+			for _, s := range v.Shortlinks {
+				if isManaged(managed, s.From) {
+					v.Managed[s.From] = true
+				}
+			}
 
 			if err := tpl.ExecuteTemplate(w, "index.html", v); err != nil {
 				_500(w, err)
@@ -104,14 +273,29 @@ func indexHandler(db PublicDB) http.Handler {
 				return
 			}
 
-			emptyShortLink := Shortlink{}
-			if sl == emptyShortLink {
+			if sl.From == "" {
 				sls, err := db.AllShortlinks()
 				if err != nil {
 					_500(w, err)
 					return
 				}
-				v := search{Path: path, Shortlinks: possibleMatches(sls, path, 20)}
+				pop, err := loadPopularity(db)
+				if err != nil {
+					_500(w, err)
+					return
+				}
+				matches := possibleMatches(sls, path, 20, pop)
+				if sl, ok := autoRedirect(matches, path); autoRedirects && ok {
+					addHit(db, sl.From)
+					w.Header().Add("Location", substitute(sl, substitution))
+					w.WriteHeader(302)
+					return
+				}
+
+				v := search{Path: path, CSRF: csrfToken(r)}
+				for _, m := range matches {
+					v.Shortlinks = append(v.Shortlinks, m.shortlink)
+				}
 
 				w.WriteHeader(404)
 				if err := tpl.ExecuteTemplate(w, "search.html", v); err != nil {
@@ -120,6 +304,7 @@ func indexHandler(db PublicDB) http.Handler {
 				}
 				return
 			} else {
+				addHit(db, sl.From)
 				to := substitute(sl, substitution)
 				w.Header().Add("Location", to)
 				w.WriteHeader(302)
@@ -43,3 +43,55 @@ func TestSubstitute(t *testing.T) {
 		}
 	}
 }
+
+func TestPossibleMatches(t *testing.T) {
+	sls := []Shortlink{
+		{From: "a", To: "https://a.com"},
+		{From: "ab", To: "https://ab.com"},
+		{From: "kubernetes-dashboard", To: "https://k8s.example.com"},
+		{From: "oncall", To: "https://pager.example.com", Description: "Who is on pager duty"},
+		{From: "payroll", To: "https://pay.example.com"},
+		{From: "payments", To: "https://payments.example.com"},
+	}
+	orig := append([]Shortlink{}, sls...)
+
+	froms := func(ms []scoredShortlink) []string {
+		ret := []string{}
+		for _, m := range ms {
+			ret = append(ret, m.shortlink.From)
+		}
+		return ret
+	}
+
+	if got := froms(possibleMatches(sls, "kubernetes-dashbaord", 20, nil)); len(got) != 1 || got[0] != "kubernetes-dashboard" {
+		t.Errorf("expected a typo of a long name to only suggest it, got %v", got)
+	}
+
+	for i := range sls {
+		if !sls[i].Equal(orig[i]) {
+			t.Fatalf("expected shortlinks not to be changed, got %v", sls)
+		}
+	}
+
+	if got := froms(possibleMatches(sls, "pager", 20, nil)); len(got) == 0 || got[0] != "oncall" {
+		t.Errorf("expected description match to suggest oncall, got %v", got)
+	}
+
+	if got := froms(possibleMatches(sls, "zzzzzz", 20, nil)); len(got) != 0 {
+		t.Errorf("expected nothing above the threshold, got %v", got)
+	}
+
+	if got := froms(possibleMatches(sls, "pay", 1, nil)); len(got) != 1 || got[0] != "payroll" {
+		t.Errorf("expected payroll to win ties by order, got %v", got)
+	}
+	if got := froms(possibleMatches(sls, "pay", 1, popularity{"payments": 1})); len(got) != 1 || got[0] != "payments" {
+		t.Errorf("expected popular payments to win, got %v", got)
+	}
+
+	if sl, ok := autoRedirect(possibleMatches(sls, "kubernetes-dashbaord", 20, nil), "kubernetes-dashbaord"); !ok || sl.From != "kubernetes-dashboard" {
+		t.Errorf("expected auto-redirect to kubernetes-dashboard, got %v %v", sl, ok)
+	}
+	if _, ok := autoRedirect(possibleMatches(sls, "paymens", 20, nil), "pay"); ok {
+		t.Errorf("expected no auto-redirect when more than one link is close")
+	}
+}
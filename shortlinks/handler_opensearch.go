@@ -0,0 +1,117 @@
+package shortlinks
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// openSearchDescription is an OpenSearch description document, which lets
+// browsers use the server as a search engine so that typing go foo in the
+// address bar goes to /foo.  See
+// https://github.com/dewitt/opensearch/blob/master/opensearch-1-1-draft-6.md
+type openSearchDescription struct {
+	XMLName       xml.Name        `xml:"http://a9.com/-/spec/opensearch/1.1/ OpenSearchDescription"`
+	ShortName     string          `xml:"ShortName"`
+	Description   string          `xml:"Description"`
+	InputEncoding string          `xml:"InputEncoding"`
+	Image         openSearchImage `xml:"Image"`
+	URLs          []openSearchURL `xml:"Url"`
+}
+
+type openSearchImage struct {
+	Width  int    `xml:"width,attr"`
+	Height int    `xml:"height,attr"`
+	Type   string `xml:"type,attr"`
+	URL    string `xml:",chardata"`
+}
+
+type openSearchURL struct {
+	Type     string `xml:"type,attr"`
+	Method   string `xml:"method,attr,omitempty"`
+	Template string `xml:"template,attr"`
+}
+
+// baseURL is the scheme and host r was made to, for documents that need
+// absolute URLs.
+func baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+func openSearchHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		base := baseURL(r)
+
+		w.Header().Add("Content-Type", "application/opensearchdescription+xml")
+		w.Write([]byte(xml.Header))
+		e := xml.NewEncoder(w)
+		e.Indent("", "  ")
+		if err := e.Encode(openSearchDescription{
+			ShortName:     "go links",
+			Description:   "go links at " + r.Host,
+			InputEncoding: "UTF-8",
+			Image:         openSearchImage{Width: 16, Height: 16, Type: "image/svg+xml", URL: base + "/_favicon"},
+			URLs: []openSearchURL{
+				{Type: "text/html", Method: "get", Template: base + "/{searchTerms}"},
+				{Type: "application/x-suggestions+json", Template: base + "/_suggest?q={searchTerms}"},
+			},
+		}); err != nil {
+			_500(w, err)
+			return
+		}
+	})
+}
+
+// suggestHandler serves /_suggest?q= in the OpenSearch suggestions format:
+// the query, then shortlinks that it might be, their descriptions and where
+// they go.  See
+// https://github.com/dewitt/opensearch/blob/master/mediawiki/Specifications/OpenSearch/Extensions/Suggestions/1.1/Draft%201.wiki
+//
+// On the public server suggestions go through the server rather than straight
+// to their destinations, so that the allowlist still applies.
+func suggestHandler(db PublicDB, public bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := strings.TrimSpace(r.URL.Query().Get("q"))
+
+		names, descriptions, urls := []string{}, []string{}, []string{}
+		if q != "" {
+			sls, err := db.AllShortlinks()
+			if err != nil {
+				_500(w, err)
+				return
+			}
+			pop, err := loadPopularity(db)
+			if err != nil {
+				_500(w, err)
+				return
+			}
+
+			path, substitution := split("/" + q)
+			for _, m := range possibleMatches(sls, path, 10, pop) {
+				name := m.shortlink.From
+				if substitution != "" {
+					name += "/" + substitution
+				}
+				names = append(names, name)
+				descriptions = append(descriptions, m.shortlink.Description)
+				if public {
+					urls = append(urls, baseURL(r)+(&url.URL{Path: "/" + name}).EscapedPath())
+				} else {
+					urls = append(urls, substitute(m.shortlink, substitution))
+				}
+			}
+		}
+
+		w.Header().Add("Content-Type", "application/x-suggestions+json")
+		if err := json.NewEncoder(w).Encode([]interface{}{q, names, descriptions, urls}); err != nil {
+			_500(w, err)
+			return
+		}
+	})
+}
@@ -4,13 +4,31 @@ import (
 	"fmt"
 	"net/http"
 	"os"
-	"strings"
 )
 
-func publicIndexHandler(db PublicDB) http.Handler {
+type leaving struct {
+	To, Host string
+}
+
+func (l leaving) Title() string { return "leaving to " + l.Host }
+
+func publicIndexHandler(db PublicDB, allowed DomainList) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path == "/" {
-			sl, err := db.AllShortlinks()
+			o, err := parseListOptions(r.URL.Query())
+			if err != nil || o.Author != "" {
+				w.Header().Add("Content-Type", "text/plain")
+				w.WriteHeader(400)
+				fmt.Fprintln(w, "bad request")
+				return
+			}
+			v, err := newIndex(db, o, "/?tag=")
+			if badListOptions(err) {
+				w.Header().Add("Content-Type", "text/plain")
+				w.WriteHeader(400)
+				fmt.Fprintln(w, "bad request")
+				return
+			}
 			if err != nil {
 				fmt.Fprintln(os.Stderr, err)
 				w.Header().Add("Content-Type", "text/plain")
@@ -18,7 +36,7 @@ func publicIndexHandler(db PublicDB) http.Handler {
 				fmt.Fprintln(w, "couldn't load links")
 				return
 			}
-			v := index{Shortlinks: sl}
+			v.Public = true
 
 			if err := tpl.ExecuteTemplate(w, "public_index.html", v); err != nil {
 				fmt.Fprintln(os.Stderr, err)
@@ -30,7 +48,8 @@ func publicIndexHandler(db PublicDB) http.Handler {
 			return
 		}
 
-		sl, err := db.Shortlink(strings.TrimPrefix(r.URL.Path, "/"))
+		path, substitution := split(r.URL.Path)
+		sl, err := db.Shortlink(path)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, err)
 			w.Header().Add("Content-Type", "text/plain")
@@ -38,7 +57,29 @@ func publicIndexHandler(db PublicDB) http.Handler {
 			fmt.Fprintln(w, "couldn't load link")
 			return
 		}
-		w.Header().Add("Location", sl.To)
+		if sl.To == "" {
+			w.Header().Add("Content-Type", "text/plain")
+			w.WriteHeader(404)
+			fmt.Fprintln(w, "not found")
+			return
+		}
+
+		// With an allowlist configured, anything pointing elsewhere gets
+		// an interstitial rather than a redirect, so that we can't be used
+		// as an open redirector.
+		to := substitute(sl, substitution)
+		if host := destinationHost(to); len(allowed) != 0 && !allowed.Match(host) {
+			if err := tpl.ExecuteTemplate(w, "leaving.html", leaving{To: to, Host: host}); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				w.Header().Add("Content-Type", "text/plain")
+				w.WriteHeader(500)
+				fmt.Fprintln(w, "couldn't execute template")
+			}
+			return
+		}
+
+		addHit(db, sl.From)
+		w.Header().Add("Location", to)
 		w.WriteHeader(302)
 
 	})
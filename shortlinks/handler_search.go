@@ -0,0 +1,81 @@
+package shortlinks
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type searchResults struct {
+	Query   string
+	Results []SearchResult
+}
+
+func (s searchResults) Title() string {
+	if s.Query == "" {
+		return "Search"
+	}
+	return "Search for " + s.Query
+}
+
+// jsonSearchResult is a SearchResult as served by the search API.
+type jsonSearchResult struct {
+	From        string   `json:"from"`
+	To          string   `json:"to"`
+	Description string   `json:"description,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Score       int      `json:"score"`
+}
+
+const (
+	defaultSearchLimit = 50
+	maxSearchLimit     = 1000
+)
+
+// searchHandler serves /_search?q=, as HTML or, if asked for with format=json
+// or an Accept header, as JSON.
+func searchHandler(db PublicDB) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query().Get("q")
+
+		limit := defaultSearchLimit
+		if l := r.URL.Query().Get("limit"); l != "" {
+			var err error
+			limit, err = strconv.Atoi(l)
+			if err != nil || limit < 1 || limit > maxSearchLimit {
+				_400(w, fmt.Errorf("limit must be between 1 and %d", maxSearchLimit))
+				return
+			}
+		}
+
+		results, err := Search(db, q, limit)
+		if err != nil {
+			_500(w, err)
+			return
+		}
+
+		if r.URL.Query().Get("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json") {
+			v := struct {
+				Query   string             `json:"query"`
+				Results []jsonSearchResult `json:"results"`
+			}{Query: q, Results: []jsonSearchResult{}}
+			for _, r := range results {
+				v.Results = append(v.Results, jsonSearchResult{From: r.From, To: r.To, Description: r.Description, Tags: r.Tags, Score: r.Score})
+			}
+
+			w.Header().Add("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(v); err != nil {
+				_500(w, err)
+				return
+			}
+			return
+		}
+
+		if err := tpl.ExecuteTemplate(w, "search_results.html", searchResults{Query: q, Results: results}); err != nil {
+			_500(w, err)
+			return
+		}
+	})
+}
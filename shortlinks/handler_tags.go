@@ -0,0 +1,64 @@
+package shortlinks
+
+import (
+	"net/http"
+	"strings"
+)
+
+type tagList struct {
+	TagCounts []TagCount
+}
+
+func (tagList) Title() string { return "tags" }
+
+// tagsHandler serves /_tags/, listing every tag, and /_tags/{tag}, listing
+// the shortlinks tagged with it.
+func tagsHandler(db PublicDB, managed Managed) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tag := strings.TrimPrefix(r.URL.Path, "/_tags/")
+
+		if tag == "" {
+			sls, err := db.AllShortlinks()
+			if err != nil {
+				_500(w, err)
+				return
+			}
+			if err := tpl.ExecuteTemplate(w, "tags.html", tagList{TagCounts: AllTags(sls)}); err != nil {
+				_500(w, err)
+				return
+			}
+			return
+		}
+
+		o, err := parseListOptions(r.URL.Query())
+		if err != nil {
+			_400(w, err)
+			return
+		}
+		o.Tag = tag
+
+		v, err := newIndex(db, o, "/_tags/")
+		if err != nil {
+			if badListOptions(err) {
+				_400(w, err)
+				return
+			}
+			_500(w, err)
+			return
+		}
+		v.CSRF = csrfToken(r)
+		v.Managed = map[string]bool{}
+		for _, s := range v.Shortlinks {
+			if isManaged(managed, s.From) {
+				v.Managed[s.From] = true
+			}
+		}
+		if len(v.Shortlinks) == 0 && o.Cursor == "" {
+			w.WriteHeader(404)
+		}
+		if err := tpl.ExecuteTemplate(w, "index.html", v); err != nil {
+			_500(w, err)
+			return
+		}
+	})
+}
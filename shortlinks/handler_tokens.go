@@ -0,0 +1,130 @@
+package shortlinks
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type tokens struct {
+	Tokens []Token
+
+	// Secret is set right after minting a token, since it can't be
+	// shown again.
+	Secret string
+
+	// Admin is set if the user may manage every token and mint admin
+	// tokens.
+	Admin bool
+
+	CSRF string
+}
+
+func (t tokens) Title() string { return "api tokens" }
+
+// tokenUser returns who is managing tokens in r and whether they are an
+// admin.  Requests made with a token act as its owner, and are admins if the
+// token has admin scope; everyone else is an admin if they are in admins.
+func tokenUser(r *http.Request, auth Auth, admins []string) (string, bool, error) {
+	if t, ok := TokenFrom(r.Context()); ok {
+		return t.Owner, t.HasScope(ScopeAdmin), nil
+	}
+
+	u, _, err := authenticate(auth, r)
+	if err != nil {
+		return "", false, err
+	}
+	return u, slices.Contains(admins, u), nil
+}
+
+func tokensHandler(db DBTokens, auth Auth, admins []string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, admin, err := tokenUser(r, auth, admins)
+		if err != nil {
+			_403(w, err)
+			return
+		}
+
+		v := tokens{Admin: admin, CSRF: csrfToken(r)}
+
+		all, err := db.Tokens()
+		if err != nil {
+			_500(w, err)
+			return
+		}
+		for _, t := range all {
+			if admin || t.Owner == u {
+				v.Tokens = append(v.Tokens, t)
+			}
+		}
+
+		if r.Method == "POST" {
+			if err := r.ParseForm(); err != nil {
+				_500(w, err)
+				return
+			}
+
+			switch r.Form.Get("action") {
+			case "create":
+				name := strings.TrimSpace(r.Form.Get("name"))
+				if name == "" {
+					_400(w, errors.New("name is required"))
+					return
+				}
+				scope := r.Form.Get("scope")
+				if _, ok := scopeLevel[scope]; !ok {
+					_400(w, errors.New("invalid scope: "+scope))
+					return
+				}
+				if scope == ScopeAdmin && !admin {
+					_403(w, errors.New("only admins may mint admin tokens"))
+					return
+				}
+				// Tokens that never expire have to be asked for,
+				// rather than being what a missing expiry means.
+				var ttl time.Duration
+				if r.Form.Get("never") == "" {
+					d := r.Form.Get("days")
+					n, err := strconv.Atoi(d)
+					if err != nil || n < 1 {
+						_400(w, errors.New("expiry must be a positive number of days, or never: "+d))
+						return
+					}
+					ttl = time.Duration(n) * 24 * time.Hour
+				}
+
+				secret, t := NewToken(name, u, []string{scope}, ttl)
+				if err := db.CreateToken(t); err != nil {
+					_500(w, err)
+					return
+				}
+				v.Secret = secret
+				v.Tokens = append(v.Tokens, t)
+			case "revoke":
+				id := r.Form.Get("id")
+				if !slices.ContainsFunc(v.Tokens, func(t Token) bool { return t.ID == id }) {
+					_403(w, errors.New("no such token of yours: "+id))
+					return
+				}
+				if err := db.RevokeToken(id); err != nil {
+					_500(w, err)
+					return
+				}
+				w.Header().Add("Location", "/_tokens/")
+				w.WriteHeader(303)
+				return
+			default:
+				_400(w, errors.New("unknown action"))
+				return
+			}
+		}
+
+		if err := tpl.ExecuteTemplate(w, "tokens.html", v); err != nil {
+			_500(w, err)
+			return
+		}
+	})
+}
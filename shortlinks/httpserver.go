@@ -2,6 +2,7 @@ package shortlinks
 
 import (
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 )
@@ -9,37 +10,112 @@ import (
 type Server struct {
 	DB   DB
 	Auth Auth
+
+	// PublicAllowedDomains, if set, limits which destinations the public
+	// server will redirect to.  Links pointing anywhere else get an
+	// interstitial page instead of a redirect.
+	PublicAllowedDomains DomainList
+
+	// DeniedDomains are destinations that shortlinks may not be created
+	// for.
+	DeniedDomains DomainList
+
+	// Admins are the users that may see and revoke every API token and
+	// mint admin tokens.  Everyone else may only manage their own.
+	Admins []string
+
+	// RequireAuth requires that every request to the read-write server be
+	// authenticated, rather than just changes.
+	RequireAuth bool
+
+	// OpenRedirects lets unauthenticated users follow existing shortlinks
+	// on the read-write server even when RequireAuth is set.  Misses still
+	// require authentication.
+	OpenRedirects bool
+
+	// AutoRedirect sends users straight to a shortlink that doesn't exist
+	// if exactly one existing shortlink is very close to it, rather than
+	// suggesting it.
+	AutoRedirect bool
+
+	// Managed, if set, reports shortlinks that can't be changed through
+	// the server because they are managed elsewhere.
+	Managed Managed
+
+	// Listen, if set, is used by ListenAndServe instead of net.Listen, for
+	// example to serve on a tailnet with tsnet.Server.Listen.
+	Listen func(network, addr string) (net.Listener, error)
 }
 
-func (s Server) ListenAndServe(listen string) error {
+// Handler returns the http.Handler for the read-write server.
+func (s Server) Handler() http.Handler {
 	mux := http.NewServeMux()
 
-	mux.Handle("/", indexHandler(s.DB))
-	mux.Handle("/_delete/", deleteHandler(s.DB, s.Auth))
-	mux.Handle("/_edit/", editHandler(s.DB, s.Auth))
+	mux.Handle("/", indexHandler(s.DB, s.Managed, s.AutoRedirect))
+	mux.Handle("/_delete/", deleteHandler(s.DB, s.Auth, s.Managed))
+	mux.Handle("/_edit/", editHandler(s.DB, s.Auth, s.DeniedDomains, s.Managed))
 	mux.Handle("/_favicon", http.HandlerFunc(faviconHandler))
+	mux.Handle("/_export/", exportHandler(s.DB))
+	mux.Handle("/_import/", importHandler(s.DB, s.Auth, s.DeniedDomains, s.Managed))
+	mux.Handle("/_search", searchHandler(s.DB))
+	mux.Handle("/_search/", searchHandler(s.DB))
+	mux.Handle("/_opensearch.xml", openSearchHandler())
+	mux.Handle("/_suggest", suggestHandler(s.DB, false))
+	mux.Handle("/_tags/", tagsHandler(s.DB, s.Managed))
 
-	if dbd, ok := s.DB.(DBDeleted); ok {
+	if dbd, ok := As[DBDeleted](s.DB); ok {
 		mux.Handle("/_deleted/", deletedHandler(dbd))
 	}
+	if dbt, ok := As[DBTokens](s.DB); ok {
+		mux.Handle("/_tokens/", tokensHandler(dbt, s.Auth, s.Admins))
+	}
 
-	var h http.Handler = mux
+	var h http.Handler = csrfProtect(s.Auth, mux)
+	if s.RequireAuth {
+		h = requireAuth(s.Auth, s.DB, s.OpenRedirects, h)
+	}
 	if auth := s.Auth; auth != nil {
 		h = auth.Wrap(h)
 	}
 
+	return h
+}
+
+func (s Server) ListenAndServe(listen string) error {
+	l, err := s.listen(listen)
+	if err != nil {
+		return err
+	}
+
 	fmt.Fprintln(os.Stderr, "rw serving at", listen)
-	return http.ListenAndServe(listen, h)
+	return http.Serve(l, s.Handler())
 }
 
-func (s Server) PublicListenAndServe(listen string) error {
+func (s Server) listen(addr string) (net.Listener, error) {
+	if s.Listen != nil {
+		return s.Listen("tcp", addr)
+	}
+	return net.Listen("tcp", addr)
+}
+
+// PublicHandler returns the http.Handler for the public server.
+func (s Server) PublicHandler() http.Handler {
 	mux := http.NewServeMux()
 
-	mux.Handle("/", publicIndexHandler(s.DB))
+	mux.Handle("/", publicIndexHandler(s.DB, s.PublicAllowedDomains))
 	mux.Handle("/_favicon", http.HandlerFunc(faviconHandler))
+	mux.Handle("/_opensearch.xml", openSearchHandler())
+	mux.Handle("/_suggest", suggestHandler(s.DB, true))
+
+	return mux
+}
 
+// PublicListenAndServe serves the public server.  It always uses net.Listen,
+// even if Listen is set, so that the public server can be exposed outside of
+// a tailnet.
+func (s Server) PublicListenAndServe(listen string) error {
 	fmt.Fprintln(os.Stderr, "public serving at", listen)
-	return http.ListenAndServe(listen, mux)
+	return http.ListenAndServe(listen, s.PublicHandler())
 }
 
 func _500(w http.ResponseWriter, err error) {
@@ -55,3 +131,15 @@ func _403(w http.ResponseWriter, err error) {
 	w.WriteHeader(403)
 	fmt.Fprintln(w, "forbidden")
 }
+
+// isManaged is true if from is managed elsewhere, according to m.
+func isManaged(m Managed, from string) bool {
+	return m != nil && m.Managed(from)
+}
+
+func _400(w http.ResponseWriter, err error) {
+	fmt.Fprintln(os.Stderr, err)
+	w.Header().Add("Content-Type", "text/plain")
+	w.WriteHeader(400)
+	fmt.Fprintln(w, err)
+}
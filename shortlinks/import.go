@@ -0,0 +1,233 @@
+package shortlinks
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ImportMode controls how PlanImport treats shortlinks that already exist.
+type ImportMode string
+
+const (
+	// ImportMerge creates and updates the shortlinks in the dump and leaves
+	// everything else alone.
+	ImportMerge ImportMode = "merge"
+
+	// ImportReplace makes the database match the dump, deleting shortlinks
+	// that aren't in it.
+	ImportReplace ImportMode = "replace"
+
+	// ImportSkipExisting only creates shortlinks that don't exist yet.
+	ImportSkipExisting ImportMode = "skip-existing"
+)
+
+func ParseImportMode(s string) (ImportMode, error) {
+	switch m := ImportMode(s); m {
+	case ImportMerge, ImportReplace, ImportSkipExisting:
+		return m, nil
+	case "":
+		return ImportMerge, nil
+	default:
+		return "", fmt.Errorf("unknown import mode %q", s)
+	}
+}
+
+type ImportAction string
+
+const (
+	ActionCreate     ImportAction = "create"
+	ActionUpdate     ImportAction = "update"
+	ActionDelete     ImportAction = "delete"
+	ActionAddDeleted ImportAction = "add deleted"
+	ActionSkip       ImportAction = "skip"
+	ActionUnchanged  ImportAction = "unchanged"
+)
+
+// ImportChange is what importing will do to a single shortlink.
+type ImportChange struct {
+	Action ImportAction
+
+	// Old is the shortlink as it is now, if it exists.
+	Old Shortlink
+
+	// New is the shortlink from the dump, if it's in there.
+	New Shortlink
+
+	history []DumpedHistory
+}
+
+// Conflict is true when the shortlink already exists and points somewhere
+// else than it does in the dump.
+func (c ImportChange) Conflict() bool {
+	return c.Old.From != "" && c.New.From != "" && c.Old.To != c.New.To
+}
+
+// PlanImport works out what importing d into db would do, without changing
+// anything.  Pass the result to ApplyImport to make the changes.  Creating or
+// updating a shortlink to point at a denied destination is an error, just as
+// it is through the server; see DomainList.Allow.
+func PlanImport(db DB, d Dump, mode ImportMode, denied DomainList) ([]ImportChange, error) {
+	live, err := db.AllShortlinks()
+	if err != nil {
+		return nil, err
+	}
+	current := make(map[string]Shortlink, len(live))
+	for _, sl := range live {
+		current[sl.From] = sl
+	}
+
+	deleted := map[string]bool{}
+	if dbd, ok := As[DBDeleted](db); ok {
+		sls, err := dbd.DeletedShortlinks()
+		if err != nil {
+			return nil, err
+		}
+		for _, sl := range sls {
+			deleted[sl.From] = true
+		}
+	}
+	_, canLoad := As[DBLoader](db)
+
+	var ret []ImportChange
+	seen := map[string]bool{}
+	for _, ds := range d.Shortlinks {
+		if seen[ds.From] {
+			return nil, fmt.Errorf("%s is in the dump more than once", ds.From)
+		}
+		seen[ds.From] = true
+
+		c := ImportChange{New: ds.Shortlink(), history: ds.History}
+		old, exists := current[ds.From]
+		c.Old = old
+
+		switch {
+		case ds.Deleted && exists && mode == ImportSkipExisting:
+			c.Action = ActionSkip
+		case ds.Deleted && exists:
+			c.Action = ActionDelete
+		case ds.Deleted && !deleted[ds.From] && canLoad:
+			c.Action = ActionAddDeleted
+		case ds.Deleted:
+			c.Action = ActionUnchanged
+		case !exists:
+			c.Action = ActionCreate
+		case old.Equal(c.New):
+			c.Action = ActionUnchanged
+		case mode == ImportSkipExisting:
+			c.Action = ActionSkip
+		default:
+			c.Action = ActionUpdate
+		}
+		if c.Action == ActionCreate || c.Action == ActionUpdate {
+			if err := denied.Allow(c.New.To); err != nil {
+				return nil, fmt.Errorf("%w (%s)", err, c.New.From)
+			}
+		}
+		ret = append(ret, c)
+	}
+
+	if mode == ImportReplace {
+		for _, sl := range live {
+			if !seen[sl.From] {
+				ret = append(ret, ImportChange{Action: ActionDelete, Old: sl})
+			}
+		}
+	}
+
+	sort.SliceStable(ret, func(i, j int) bool { return importFrom(ret[i]) < importFrom(ret[j]) })
+
+	return ret, nil
+}
+
+func importFrom(c ImportChange) string {
+	if c.New.From != "" {
+		return c.New.From
+	}
+	return c.Old.From
+}
+
+// ImportSummary counts changes by action.
+func ImportSummary(changes []ImportChange) map[ImportAction]int {
+	ret := map[ImportAction]int{}
+	for _, c := range changes {
+		ret[c.Action]++
+	}
+	return ret
+}
+
+// ApplyImport makes the changes planned by PlanImport, recording them in
+// history as made by who via method.
+//
+// If db is a DBLoader, the history in the dump is loaded for shortlinks that
+// don't have any history yet, so that restoring a backup into an empty
+// database keeps it.
+func ApplyImport(db DB, changes []ImportChange, who, method string) error {
+	l, canLoad := As[DBLoader](db)
+
+	loadHistory := func(c ImportChange) error {
+		if !canLoad || len(c.history) == 0 {
+			return nil
+		}
+		hs, err := db.History(c.New.From)
+		if err != nil {
+			return err
+		}
+		if len(hs) != 0 {
+			return nil
+		}
+		for _, h := range c.history {
+			when, err := ParseWhen(h.When)
+			if err != nil {
+				return fmt.Errorf("couldn't import history for %s: %w", c.New.From, err)
+			}
+			if err := l.LoadHistory(History{
+				From:        c.New.From,
+				To:          h.To,
+				When:        when,
+				Who:         h.Who,
+				Description: h.Description,
+				Method:      h.Method,
+				Tags:        h.Tags,
+			}); err != nil {
+				return fmt.Errorf("couldn't import history for %s: %w", c.New.From, err)
+			}
+		}
+		return nil
+	}
+
+	for _, c := range changes {
+		switch c.Action {
+		case ActionCreate, ActionUpdate:
+			if err := loadHistory(c); err != nil {
+				return err
+			}
+			if err := db.InsertHistory(History{
+				From: c.New.From,
+				To:   c.New.To,
+				Who:  who,
+
+				Method:      method,
+				Description: c.New.Description,
+				Tags:        c.New.Tags,
+			}); err != nil {
+				return err
+			}
+			if err := db.CreateShortlink(c.New.touched(who)); err != nil {
+				return err
+			}
+		case ActionDelete:
+			if err := db.DeleteShortlink(c.Old.From, who, method); err != nil {
+				return err
+			}
+		case ActionAddDeleted:
+			if err := loadHistory(c); err != nil {
+				return err
+			}
+			if err := l.LoadShortlink(c.New, true); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,190 @@
+package shortlinks
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+)
+
+// ListSort is the order of a list of shortlinks.
+type ListSort string
+
+const (
+	SortName     ListSort = "name"
+	SortModified ListSort = "modified"
+	SortPopular  ListSort = "popular"
+)
+
+const (
+	defaultListLimit = 100
+	maxListLimit     = 1000
+)
+
+// listOptions are how the index is sorted, filtered and paginated.
+type listOptions struct {
+	Sort   ListSort
+	Tag    string
+	Author string
+
+	// Cursor is where the page starts, from the Next of the previous
+	// page.
+	Cursor string
+	Limit  int
+}
+
+// parseListOptions reads listOptions from the query string of a request.
+func parseListOptions(q url.Values) (listOptions, error) {
+	o := listOptions{
+		Sort:   ListSort(q.Get("sort")),
+		Tag:    q.Get("tag"),
+		Author: q.Get("author"),
+		Cursor: q.Get("cursor"),
+		Limit:  defaultListLimit,
+	}
+
+	switch o.Sort {
+	case "":
+		o.Sort = SortName
+	case SortName, SortModified, SortPopular:
+	default:
+		return o, fmt.Errorf("unknown sort %q", o.Sort)
+	}
+
+	if l := q.Get("limit"); l != "" {
+		var err error
+		o.Limit, err = strconv.Atoi(l)
+		if err != nil || o.Limit < 1 || o.Limit > maxListLimit {
+			return o, fmt.Errorf("limit must be between 1 and %d", maxListLimit)
+		}
+	}
+
+	return o, nil
+}
+
+// query is o as a query string, with the cursor set to cursor.
+func (o listOptions) query(cursor string) string {
+	q := url.Values{}
+	if o.Sort != SortName {
+		q.Set("sort", string(o.Sort))
+	}
+	if o.Tag != "" {
+		q.Set("tag", o.Tag)
+	}
+	if o.Author != "" {
+		q.Set("author", o.Author)
+	}
+	if o.Limit != defaultListLimit {
+		q.Set("limit", strconv.Itoa(o.Limit))
+	}
+	if cursor != "" {
+		q.Set("cursor", cursor)
+	}
+	return q.Encode()
+}
+
+type listPage struct {
+	Shortlinks []Shortlink
+
+	// Next is the Cursor of the next page, or empty if this is the last.
+	Next string
+}
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// badListOptions is whether err from listShortlinks is the fault of the
+// request rather than the server.
+func badListOptions(err error) bool {
+	return errors.Is(err, errInvalidCursor)
+}
+
+// listShortlinks loads a page of shortlinks.  When sorting by name without a
+// tag and db is a DBPager (or a DBAuthorPager, when filtering by author), only
+// the page is loaded and the cursor is the From to start after.  Otherwise
+// the cursor is an offset, and unless db is a DBPopularPager and the sort is
+// by popularity without filters, every shortlink is loaded, filtered and
+// sorted.
+func listShortlinks(db PublicDB, o listOptions) (listPage, error) {
+	if o.Sort == SortName && o.Tag == "" {
+		if p, ok := As[DBPager](db); ok && o.Author == "" {
+			return page(p.ShortlinksPage(o.Cursor, o.Limit))
+		}
+		if p, ok := As[DBAuthorPager](db); ok && o.Author != "" {
+			return page(p.ShortlinksPageByAuthor(o.Author, o.Cursor, o.Limit))
+		}
+	}
+
+	offset := 0
+	if o.Cursor != "" {
+		var err error
+		offset, err = strconv.Atoi(o.Cursor)
+		if err != nil || offset < 0 {
+			return listPage{}, fmt.Errorf("%w %q", errInvalidCursor, o.Cursor)
+		}
+	}
+
+	if p, ok := As[DBPopularPager](db); ok && o.Sort == SortPopular && o.Tag == "" && o.Author == "" {
+		sls, more, err := p.ShortlinksPageByHits(offset, o.Limit)
+		if err != nil {
+			return listPage{}, err
+		}
+		ret := listPage{Shortlinks: sls}
+		if more {
+			ret.Next = strconv.Itoa(offset + o.Limit)
+		}
+		return ret, nil
+	}
+
+	sls, err := db.AllShortlinks()
+	if err != nil {
+		return listPage{}, err
+	}
+	if o.Tag != "" {
+		sls = WithTag(sls, o.Tag)
+	}
+
+	if o.Author != "" {
+		sls = byAuthor(sls, o.Author)
+	}
+
+	if o.Sort == SortModified {
+		sort.SliceStable(sls, func(i, j int) bool { return sls[i].UpdatedAt.After(sls[j].UpdatedAt) })
+	}
+
+	if o.Sort == SortPopular {
+		pop, err := loadPopularity(db)
+		if err != nil {
+			return listPage{}, err
+		}
+		sort.SliceStable(sls, func(i, j int) bool { return pop[sls[i].From] > pop[sls[j].From] })
+	}
+
+	if offset > len(sls) {
+		offset = len(sls)
+	}
+	ret := listPage{Shortlinks: sls[offset:min(offset+o.Limit, len(sls))]}
+	if offset+o.Limit < len(sls) {
+		ret.Next = strconv.Itoa(offset + o.Limit)
+	}
+	return ret, nil
+}
+
+// page is a listPage from the results of a DBPager.
+func page(sls []Shortlink, next string, err error) (listPage, error) {
+	if err != nil {
+		return listPage{}, err
+	}
+	return listPage{Shortlinks: sls, Next: next}, nil
+}
+
+// byAuthor returns the shortlinks in sls created or last updated by author.
+func byAuthor(sls []Shortlink, author string) []Shortlink {
+	ret := []Shortlink{}
+	for _, sl := range sls {
+		if sl.CreatedBy == author || sl.UpdatedBy == author {
+			ret = append(ret, sl)
+		}
+	}
+	return ret
+}
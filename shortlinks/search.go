@@ -0,0 +1,180 @@
+package shortlinks
+
+import (
+	"html"
+	"html/template"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/hbollon/go-edlib"
+)
+
+// SearchResult is a shortlink found by Search.
+type SearchResult struct {
+	Shortlink
+
+	// Score ranks results; higher is better.
+	Score int
+
+	terms []string
+}
+
+// Scores for each way a term can match, summed over the terms in a query.
+const (
+	scoreExact       = 100
+	scoreFromPrefix  = 50
+	scoreFromWord    = 40
+	scoreFromPrefixW = 30
+	scoreTag         = 25
+	scoreDescWord    = 20
+	scoreDescPrefix  = 15
+	scoreToWord      = 10
+	scoreToPrefix    = 8
+	scoreFuzzy       = 5
+)
+
+// searchTerms splits q into lower case words.
+func searchTerms(q string) []string {
+	return strings.FieldsFunc(strings.ToLower(q), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// score returns how well term matches sl, or 0 if it doesn't.
+func score(sl Shortlink, term string) int {
+	from := strings.ToLower(sl.From)
+
+	switch {
+	case from == term:
+		return scoreExact
+	case strings.HasPrefix(from, term):
+		return scoreFromPrefix
+	}
+
+	best := 0
+	words := func(s string, word, prefix int) {
+		for _, w := range searchTerms(s) {
+			switch {
+			case w == term:
+				best = max(best, word)
+			case strings.HasPrefix(w, term):
+				best = max(best, prefix)
+			}
+		}
+	}
+	words(sl.From, scoreFromWord, scoreFromPrefixW)
+	words(strings.Join(sl.Tags, " "), scoreTag, scoreDescPrefix)
+	words(sl.Description, scoreDescWord, scoreDescPrefix)
+	words(sl.To, scoreToWord, scoreToPrefix)
+	if best != 0 {
+		return best
+	}
+
+	// Allow a typo for every four letters, so that short terms don't match
+	// everything.
+	if d := edlib.DamerauLevenshteinDistance(term, from); len(term) >= 4 && d <= len(term)/4 {
+		return scoreFuzzy
+	}
+
+	return 0
+}
+
+// rank scores every shortlink against terms, dropping those that don't match
+// all of them, and returns the best limit, best first.
+func rank(sls []Shortlink, terms []string, limit int) []SearchResult {
+	var ret []SearchResult
+shortlinks:
+	for _, sl := range sls {
+		r := SearchResult{Shortlink: sl, terms: terms}
+		for _, t := range terms {
+			s := score(sl, t)
+			if s == 0 {
+				continue shortlinks
+			}
+			r.Score += s
+		}
+		ret = append(ret, r)
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Score != ret[j].Score {
+			return ret[i].Score > ret[j].Score
+		}
+		return ret[i].From < ret[j].From
+	})
+
+	if limit > 0 && len(ret) > limit {
+		ret = ret[:limit]
+	}
+	return ret
+}
+
+// Search finds up to limit shortlinks matching every word in q, best first.
+// A word matches a shortlink if its From is or starts with the word, if a
+// word in its From, Tags, Description or To starts with it, or, failing
+// those, if its From is within a typo or so of the word.
+//
+// If db is a DBSearch it is used to narrow down the shortlinks to rank,
+// otherwise every shortlink is ranked in memory.  Either way, if nothing
+// matches, every shortlink is checked for typos.
+func Search(db PublicDB, q string, limit int) ([]SearchResult, error) {
+	terms := searchTerms(q)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	if dbs, ok := As[DBSearch](db); ok {
+		sls, err := dbs.SearchShortlinks(terms)
+		if err != nil {
+			return nil, err
+		}
+		if ret := rank(sls, terms, limit); len(ret) != 0 {
+			return ret, nil
+		}
+	}
+
+	sls, err := db.AllShortlinks()
+	if err != nil {
+		return nil, err
+	}
+	return rank(sls, terms, limit), nil
+}
+
+// highlight escapes s, wrapping the words that start with any of terms in
+// <mark>.
+func highlight(s string, terms []string) template.HTML {
+	var b strings.Builder
+	rs := []rune(s)
+	for i := 0; i < len(rs); {
+		if !unicode.IsLetter(rs[i]) && !unicode.IsDigit(rs[i]) {
+			b.WriteString(html.EscapeString(string(rs[i])))
+			i++
+			continue
+		}
+
+		j := i
+		for j < len(rs) && (unicode.IsLetter(rs[j]) || unicode.IsDigit(rs[j])) {
+			j++
+		}
+		word := string(rs[i:j])
+		n := 0
+		for _, t := range terms {
+			if strings.HasPrefix(strings.ToLower(word), t) {
+				n = max(n, len([]rune(t)))
+			}
+		}
+		if n != 0 {
+			b.WriteString("<mark>" + html.EscapeString(string(rs[i:i+n])) + "</mark>")
+		}
+		b.WriteString(html.EscapeString(string(rs[i+n : j])))
+		i = j
+	}
+	return template.HTML(b.String())
+}
+
+func (r SearchResult) HighlightedFrom() template.HTML { return highlight(r.From, r.terms) }
+func (r SearchResult) HighlightedTo() template.HTML   { return highlight(r.To, r.terms) }
+func (r SearchResult) HighlightedDescription() template.HTML {
+	return highlight(r.Description, r.terms)
+}
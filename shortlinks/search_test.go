@@ -0,0 +1,60 @@
+package shortlinks
+
+import (
+	"testing"
+)
+
+func TestRank(t *testing.T) {
+	sls := []Shortlink{
+		{From: "doc", To: "https://a.com"},
+		{From: "docs", To: "https://b.com"},
+		{From: "api-docs", To: "https://c.com"},
+		{From: "handbook", To: "https://d.com", Description: "Docs for people"},
+		{From: "x", To: "https://docs.example.com"},
+		{From: "unrelated", To: "https://e.com"},
+	}
+
+	got := rank(sls, []string{"doc"}, 0)
+	want := []string{"doc", "docs", "api-docs", "handbook", "x"}
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %+v", want, got)
+	}
+	for i := range want {
+		if got[i].From != want[i] {
+			t.Errorf("expected result %d to be %s, got %s (%d)", i, want[i], got[i].From, got[i].Score)
+		}
+	}
+
+	if got := rank(sls, []string{"doc"}, 2); len(got) != 2 {
+		t.Errorf("expected limit to be respected, got %d results", len(got))
+	}
+
+	if got := rank(sls, []string{"docs", "people"}, 0); len(got) != 1 || got[0].From != "handbook" {
+		t.Errorf("expected every term to have to match, got %+v", got)
+	}
+
+	if got := rank(sls, []string{"handbok"}, 0); len(got) != 1 || got[0].From != "handbook" {
+		t.Errorf("expected typo to match handbook, got %+v", got)
+	}
+
+	if got := rank(sls, []string{"dcs"}, 0); len(got) != 0 {
+		t.Errorf("expected short terms not to fuzzy match, got %+v", got)
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	for _, test := range []struct {
+		s        string
+		terms    []string
+		expected string
+	}{
+		{"Team docs", []string{"doc"}, "Team <mark>doc</mark>s"},
+		{"DOCS & <stuff>", []string{"docs", "stu"}, "<mark>DOCS</mark> &amp; &lt;<mark>stu</mark>ff&gt;"},
+		{"https://docs.example.com/%s", []string{"ex"}, "https://docs.<mark>ex</mark>ample.com/%s"},
+		{"no match", []string{"zzz"}, "no match"},
+	} {
+		if got := string(highlight(test.s, test.terms)); got != test.expected {
+			t.Errorf("highlight(%q, %v): expected %q, got %q", test.s, test.terms, test.expected, got)
+		}
+	}
+}
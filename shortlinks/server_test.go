@@ -0,0 +1,535 @@
+package shortlinks_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/frioux/shortlinks/shortlinks"
+	"github.com/frioux/shortlinks/storage/memstorage"
+)
+
+type testAuth struct{}
+
+func (testAuth) Wrap(h http.Handler) http.Handler   { return h }
+func (testAuth) User(*http.Request) (string, error) { return "frew", nil }
+func (testAuth) Name() string                       { return "test" }
+
+type client struct {
+	t *testing.T
+	*http.Client
+	base string
+}
+
+func newClient(t *testing.T, h http.Handler) *client {
+	ts := httptest.NewServer(h)
+	t.Cleanup(ts.Close)
+
+	jar, _ := cookiejar.New(nil)
+	return &client{
+		t: t,
+		Client: &http.Client{
+			Jar: jar,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		base: ts.URL,
+	}
+}
+
+func (c *client) csrf() string {
+	u, _ := url.Parse(c.base)
+	for _, ck := range c.Jar.Cookies(u) {
+		if ck.Name == "shortlinks_csrf" {
+			return ck.Value
+		}
+	}
+	c.t.Fatal("no csrf cookie")
+	return ""
+}
+
+func (c *client) do(method, path string, form url.Values) (int, http.Header, string) {
+	c.t.Helper()
+
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	req, err := http.NewRequest(method, c.base+path, body)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	resp, err := c.Do(req)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+
+	return resp.StatusCode, resp.Header, string(b)
+}
+
+func TestServerFlow(t *testing.T) {
+	db := memstorage.New()
+	c := newClient(t, shortlinks.Server{DB: db, Auth: testAuth{}}.Handler())
+
+	if code, _, _ := c.do("GET", "/", nil); code != 200 {
+		t.Fatalf("expected index to load, got %d", code)
+	}
+
+	if code, _, _ := c.do("POST", "/_edit/", url.Values{"from": {"foo"}, "to": {"https://foo.com/%s"}}); code != 403 {
+		t.Errorf("expected post without csrf token to be forbidden, got %d", code)
+	}
+
+	code, h, _ := c.do("POST", "/_edit/", url.Values{
+		"csrf":        {c.csrf()},
+		"from":        {"foo"},
+		"to":          {"https://foo.com/%s"},
+		"description": {"the foo"},
+	})
+	if code != 302 || h.Get("Location") != "/" {
+		t.Fatalf("expected create to redirect to index, got %d %s", code, h.Get("Location"))
+	}
+
+	if code, h, _ := c.do("GET", "/foo/bar", nil); code != 302 || h.Get("Location") != "https://foo.com/bar" {
+		t.Errorf("expected redirect to https://foo.com/bar, got %d %s", code, h.Get("Location"))
+	}
+
+	if code, _, body := c.do("GET", "/fo", nil); code != 404 || !strings.Contains(body, "the foo") {
+		t.Errorf("expected 404 suggesting foo, got %d: %s", code, body)
+	}
+
+	if code, _, body := c.do("GET", "/_edit/?from=foo", nil); code != 200 || !strings.Contains(body, "by frew via test") || !strings.Contains(body, `<time datetime="`) {
+		t.Errorf("expected history on edit page, got %d: %s", code, body)
+	}
+
+	if sl, _ := db.Shortlink("foo"); sl.CreatedBy != "frew" || sl.UpdatedBy != "frew" || sl.CreatedAt.IsZero() || !sl.UpdatedAt.Equal(sl.CreatedAt) {
+		t.Errorf("expected foo to be created and updated by frew, got %+v", sl)
+	}
+	if _, _, body := c.do("GET", "/", nil); !strings.Contains(body, " by frew</small>") {
+		t.Errorf("expected who last changed foo in the index, got %s", body)
+	}
+
+	if code, _, _ := c.do("POST", "/_delete/", url.Values{"csrf": {c.csrf()}, "from": {"foo"}}); code != 303 {
+		t.Errorf("expected delete to redirect, got %d", code)
+	}
+
+	if code, _, _ := c.do("GET", "/foo", nil); code != 404 {
+		t.Errorf("expected deleted link to 404, got %d", code)
+	}
+
+	if code, _, body := c.do("GET", "/_deleted/", nil); code != 200 || !strings.Contains(body, ">foo<") {
+		t.Errorf("expected foo on deleted page, got %d: %s", code, body)
+	}
+}
+
+func TestAutoRedirect(t *testing.T) {
+	db := memstorage.New()
+	for _, sl := range []shortlinks.Shortlink{
+		{From: "kubernetes", To: "https://k8s.example.com/%s"},
+		{From: "wiki", To: "https://wiki.example.com"},
+	} {
+		if err := db.CreateShortlink(sl); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := newClient(t, shortlinks.Server{DB: db}.Handler())
+	if code, _, _ := c.do("GET", "/kubernets/pods", nil); code != 404 {
+		t.Errorf("expected suggestions without AutoRedirect, got %d", code)
+	}
+
+	c = newClient(t, shortlinks.Server{DB: db, AutoRedirect: true}.Handler())
+	if code, h, _ := c.do("GET", "/kubernets/pods", nil); code != 302 || h.Get("Location") != "https://k8s.example.com/pods" {
+		t.Errorf("expected redirect to https://k8s.example.com/pods, got %d %s", code, h.Get("Location"))
+	}
+	if code, _, _ := c.do("GET", "/zz", nil); code != 404 {
+		t.Errorf("expected 404 for something unlike any link, got %d", code)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	db := memstorage.New()
+	for _, sl := range []shortlinks.Shortlink{
+		{From: "docs", To: "https://docs.example.com", Description: "Team <docs>"},
+		{From: "ci", To: "https://ci.example.com"},
+	} {
+		if err := db.CreateShortlink(sl); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := newClient(t, shortlinks.Server{DB: db}.Handler())
+
+	if code, _, body := c.do("GET", "/_search?q=doc", nil); code != 200 || !strings.Contains(body, "<mark>doc</mark>s") || !strings.Contains(body, "&lt;<mark>doc</mark>s&gt;") || strings.Contains(body, ">ci<") {
+		t.Errorf("expected highlighted docs and not ci, got %d: %s", code, body)
+	}
+
+	code, h, body := c.do("GET", "/_search/?q=example&format=json&limit=1", nil)
+	if code != 200 || h.Get("Content-Type") != "application/json" {
+		t.Fatalf("expected json, got %d %s", code, h.Get("Content-Type"))
+	}
+	if !strings.Contains(body, `"results":[{"from":"ci","to":"https://ci.example.com","score":10}]`) {
+		t.Errorf("expected just ci, got %s", body)
+	}
+
+	if code, _, _ := c.do("GET", "/_search?q=x&limit=0", nil); code != 400 {
+		t.Errorf("expected bad limit to be rejected, got %d", code)
+	}
+}
+
+func TestOpenSearch(t *testing.T) {
+	db := memstorage.New()
+	for _, sl := range []shortlinks.Shortlink{
+		{From: "jira", To: "https://jira.example.com/browse/%s", Description: "Tickets"},
+		{From: "jenkins", To: "https://ci.example.com"},
+		{From: "wiki", To: "https://wiki.example.com"},
+	} {
+		if err := db.CreateShortlink(sl); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := newClient(t, shortlinks.Server{DB: db}.Handler())
+
+	if _, _, body := c.do("GET", "/", nil); !strings.Contains(body, `href="/_opensearch.xml"`) {
+		t.Errorf("expected index to link the opensearch description, got %s", body)
+	}
+
+	code, h, body := c.do("GET", "/_opensearch.xml", nil)
+	if code != 200 || h.Get("Content-Type") != "application/opensearchdescription+xml" {
+		t.Fatalf("expected opensearch description, got %d %s", code, h.Get("Content-Type"))
+	}
+	if !strings.Contains(body, `template="`+c.base+`/{searchTerms}"`) || !strings.Contains(body, `template="`+c.base+`/_suggest?q={searchTerms}"`) {
+		t.Errorf("expected search and suggestion templates, got %s", body)
+	}
+
+	code, _, body = c.do("GET", "/_suggest?q=ji", nil)
+	if code != 200 || strings.TrimSpace(body) != `["ji",["jira"],["Tickets"],["https://jira.example.com/browse/"]]` {
+		t.Errorf("expected jira to be suggested, got %d %s", code, body)
+	}
+
+	if _, _, body := c.do("GET", "/_suggest?q=jira/ABC-1", nil); strings.TrimSpace(body) != `["jira/ABC-1",["jira/ABC-1"],["Tickets"],["https://jira.example.com/browse/ABC-1"]]` {
+		t.Errorf("expected suggestion with substitution, got %s", body)
+	}
+
+	if _, _, body := c.do("GET", "/_suggest?q=", nil); strings.TrimSpace(body) != `["",[],[],[]]` {
+		t.Errorf("expected no suggestions, got %s", body)
+	}
+}
+
+type managed map[string]bool
+
+func (m managed) Managed(from string) bool { return m[from] }
+
+func TestManaged(t *testing.T) {
+	db := memstorage.New()
+	if err := db.CreateShortlink(shortlinks.Shortlink{From: "docs", To: "https://docs.example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	c := newClient(t, shortlinks.Server{DB: db, Auth: testAuth{}, Managed: managed{"docs": true}}.Handler())
+
+	if code, _, body := c.do("GET", "/", nil); code != 200 || !strings.Contains(body, ">managed<") {
+		t.Errorf("expected docs to be marked managed, got %d: %s", code, body)
+	}
+
+	if code, _, body := c.do("GET", "/_edit/?from=docs", nil); code != 200 || strings.Contains(body, `value="Delete"`) {
+		t.Errorf("expected read-only edit page, got %d: %s", code, body)
+	}
+
+	if code, _, _ := c.do("POST", "/_edit/", url.Values{"csrf": {c.csrf()}, "from": {"docs"}, "to": {"https://evil.example.com"}}); code != 403 {
+		t.Errorf("expected editing a managed link to be forbidden, got %d", code)
+	}
+
+	if code, _, _ := c.do("POST", "/_delete/", url.Values{"csrf": {c.csrf()}, "from": {"docs"}}); code != 403 {
+		t.Errorf("expected deleting a managed link to be forbidden, got %d", code)
+	}
+
+	if sl, _ := db.Shortlink("docs"); sl.To != "https://docs.example.com" {
+		t.Errorf("expected docs to be unchanged, got %+v", sl)
+	}
+
+	if code, _, _ := c.do("POST", "/_edit/", url.Values{"csrf": {c.csrf()}, "from": {"other"}, "to": {"https://other.example.com"}}); code != 302 {
+		t.Errorf("expected unmanaged links to still be editable, got %d", code)
+	}
+}
+
+func TestTags(t *testing.T) {
+	db := memstorage.New()
+	s := shortlinks.Server{DB: db, Auth: testAuth{}}
+	c := newClient(t, s.Handler())
+	c.do("GET", "/", nil)
+
+	if code, _, _ := c.do("POST", "/_edit/", url.Values{"csrf": {c.csrf()}, "from": {"a"}, "to": {"https://a.com"}, "tags": {"Eng, docs docs"}}); code != 302 {
+		t.Fatalf("expected create to redirect, got %d", code)
+	}
+	if code, _, _ := c.do("POST", "/_edit/", url.Values{"csrf": {c.csrf()}, "from": {"b"}, "to": {"https://b.com"}, "tags": {"ops"}}); code != 302 {
+		t.Fatalf("expected create to redirect, got %d", code)
+	}
+	if code, _, _ := c.do("POST", "/_edit/", url.Values{"csrf": {c.csrf()}, "from": {"c"}, "to": {"https://c.com"}, "tags": {"no/slash"}}); code != 400 {
+		t.Errorf("expected invalid tag to be rejected, got %d", code)
+	}
+
+	if sl, _ := db.Shortlink("a"); !sl.Equal(shortlinks.Shortlink{From: "a", To: "https://a.com", Tags: []string{"docs", "eng"}}) {
+		t.Errorf("expected normalized tags, got %+v", sl)
+	}
+
+	if _, _, body := c.do("GET", "/?tag=eng", nil); !strings.Contains(body, ">a<") || strings.Contains(body, ">b<") || !strings.Contains(body, `href="/_tags/"`) {
+		t.Errorf("expected index filtered to a, linking to every tag, got %s", body)
+	}
+
+	if code, _, body := c.do("GET", "/_tags/", nil); code != 200 || !strings.Contains(body, `<a href="/_tags/eng">eng</a> (1)`) {
+		t.Errorf("expected tag list, got %d: %s", code, body)
+	}
+	if code, _, body := c.do("GET", "/_tags/ops", nil); code != 200 || !strings.Contains(body, ">b<") || strings.Contains(body, ">a<") {
+		t.Errorf("expected ops tag page with b, got %d: %s", code, body)
+	}
+	if code, _, _ := c.do("GET", "/_tags/nope", nil); code != 404 {
+		t.Errorf("expected unused tag to 404, got %d", code)
+	}
+
+	if _, _, body := c.do("GET", "/_edit/?from=a", nil); !strings.Contains(body, `value="docs eng"`) || !strings.Contains(body, "tagged docs, eng") {
+		t.Errorf("expected tags in form and history, got %s", body)
+	}
+
+	p := newClient(t, s.PublicHandler())
+	if _, _, body := p.do("GET", "/?tag=ops", nil); !strings.Contains(body, ">b<") || strings.Contains(body, ">a<") || !strings.Contains(body, `href="/?tag=ops"`) {
+		t.Errorf("expected public index filtered to b, got %s", body)
+	}
+}
+
+// listed returns the shortlinks listed on an index page, in order.
+func listed(body string) string {
+	var ret []string
+	for _, l := range strings.Split(body, "\n") {
+		if strings.HasPrefix(l, "<li>") {
+			l = l[strings.Index(l, ">")+1:]
+			ret = append(ret, l[strings.Index(l, ">")+1:strings.Index(l, "</a>")])
+		}
+	}
+	return strings.Join(ret, " ")
+}
+
+func TestIndexPaging(t *testing.T) {
+	db := memstorage.New()
+	for i, sl := range []struct{ from, who, when string }{
+		{"a", "frew", "2024-01-03 00:00:00"},
+		{"b", "alice", "2024-01-01 00:00:00"},
+		{"c", "frew", "2024-01-02 00:00:00"},
+	} {
+		when, _ := shortlinks.ParseWhen(sl.when)
+		db.CreateShortlink(shortlinks.Shortlink{From: sl.from, To: "https://" + sl.from + ".com", Tags: []string{"t" + string(rune('0'+i%2))}, UpdatedAt: when, UpdatedBy: sl.who})
+		db.LoadHistory(shortlinks.History{From: sl.from, To: "https://" + sl.from + ".com", Who: sl.who, When: when})
+	}
+	s := shortlinks.Server{DB: db, Auth: testAuth{}}
+	c := newClient(t, s.Handler())
+
+	_, _, body := c.do("GET", "/?limit=2", nil)
+	if !strings.Contains(body, ">a<") || !strings.Contains(body, ">b<") || strings.Contains(body, ">c<") || !strings.Contains(body, `href="?cursor=b&amp;limit=2"`) {
+		t.Errorf("expected first page with a link to the next, got %s", body)
+	}
+	_, _, body = c.do("GET", "/?limit=2&cursor=b", nil)
+	if strings.Contains(body, ">a<") || !strings.Contains(body, ">c<") || strings.Contains(body, "next page") {
+		t.Errorf("expected last page, got %s", body)
+	}
+
+	for _, test := range []struct {
+		query string
+		want  string
+	}{
+		{"sort=modified", "a c b"},
+		{"author=frew", "a c"},
+		{"author=frew&sort=modified&limit=1&cursor=1", "c"},
+		{"tag=t0", "a c"},
+		{"tag=t1&author=frew", ""},
+	} {
+		_, _, body := c.do("GET", "/?"+test.query, nil)
+		if got := listed(body); got != test.want {
+			t.Errorf("expected %q for %s, got %q", test.want, test.query, got)
+		}
+	}
+
+	c.do("GET", "/c", nil)
+	c.do("GET", "/c", nil)
+	c.do("GET", "/b", nil)
+	if _, _, body := c.do("GET", "/?sort=popular", nil); listed(body) != "c b a" {
+		t.Errorf("expected most used first, got %q", listed(body))
+	}
+
+	// Hits are stored, so both servers count towards the same popularity.
+	p := newClient(t, s.PublicHandler())
+	for i := 0; i < 3; i++ {
+		p.do("GET", "/a", nil)
+	}
+	if _, _, body := c.do("GET", "/?sort=popular", nil); listed(body) != "a c b" {
+		t.Errorf("expected public hits to count, got %q", listed(body))
+	}
+	if _, _, body := c.do("GET", "/?sort=popular&limit=1&cursor=1", nil); listed(body) != "c" {
+		t.Errorf("expected the second most used, got %q", listed(body))
+	}
+
+	for _, q := range []string{"sort=nope", "limit=0", "sort=modified&cursor=x"} {
+		if code, _, _ := c.do("GET", "/?"+q, nil); code != 400 {
+			t.Errorf("expected %s to be rejected, got %d", q, code)
+		}
+	}
+
+	if code, _, _ := p.do("GET", "/?author=frew", nil); code != 400 {
+		t.Errorf("expected the public index not to filter by author, got %d", code)
+	}
+}
+
+func TestPublicServer(t *testing.T) {
+	db := memstorage.New()
+	db.CreateShortlink(shortlinks.Shortlink{From: "ok", To: "https://docs.example.com/"})
+	db.CreateShortlink(shortlinks.Shortlink{From: "evil", To: "https://evil.com/"})
+	db.CreateShortlink(shortlinks.Shortlink{From: "docs", To: "https://%s.example.com/"})
+
+	c := newClient(t, shortlinks.Server{
+		DB:                   db,
+		PublicAllowedDomains: shortlinks.ParseDomainList("example.com"),
+	}.PublicHandler())
+
+	// Links and suggestions go through the server, so that the allowlist
+	// and substitution apply.
+	if _, _, body := c.do("GET", "/", nil); !strings.Contains(body, `href="/evil"`) || strings.Contains(body, "https://evil.com/") || strings.Contains(body, "%s") {
+		t.Errorf("expected the index to link through the server, got %s", body)
+	}
+	if _, _, body := c.do("GET", "/_suggest?q=evil", nil); !strings.Contains(body, `["`+c.base+`/evil"]`) {
+		t.Errorf("expected suggestions to link through the server, got %s", body)
+	}
+
+	if code, h, _ := c.do("GET", "/docs/wiki", nil); code != 302 || h.Get("Location") != "https://wiki.example.com/" {
+		t.Errorf("expected substituted redirect, got %d %s", code, h.Get("Location"))
+	}
+	if code, _, body := c.do("GET", "/docs/evil.com/x", nil); code != 200 || !strings.Contains(body, "leaving to <b>evil.com</b>") {
+		t.Errorf("expected interstitial for a substitution that changes the host, got %d: %s", code, body)
+	}
+
+	if code, h, _ := c.do("GET", "/ok", nil); code != 302 || h.Get("Location") != "https://docs.example.com/" {
+		t.Errorf("expected redirect for allowed domain, got %d %s", code, h.Get("Location"))
+	}
+
+	if code, _, body := c.do("GET", "/evil", nil); code != 200 || !strings.Contains(body, "leaving to <b>evil.com</b>") {
+		t.Errorf("expected interstitial for other domain, got %d: %s", code, body)
+	}
+
+	if code, _, _ := c.do("GET", "/missing", nil); code != 404 {
+		t.Errorf("expected 404 for missing link, got %d", code)
+	}
+}
+
+func TestImportExport(t *testing.T) {
+	db := memstorage.New()
+	c := newClient(t, shortlinks.Server{DB: db, Auth: testAuth{}}.Handler())
+	c.do("GET", "/", nil)
+
+	csv := "type,from,to,description,deleted,when,who,method\nshortlink,foo,https://foo.com,,false,,,\n"
+
+	code, _, body := c.do("POST", "/_import/", url.Values{"csrf": {c.csrf()}, "format": {"csv"}, "data": {csv}})
+	if code != 200 || !strings.Contains(body, "create: 1") {
+		t.Fatalf("expected preview, got %d: %s", code, body)
+	}
+	if sl, _ := db.Shortlink("foo"); sl.From != "" {
+		t.Fatalf("expected preview to not change anything, got %+v", sl)
+	}
+
+	code, _, _ = c.do("POST", "/_import/", url.Values{"csrf": {c.csrf()}, "format": {"csv"}, "data": {csv}, "confirm": {"1"}})
+	if code != 303 {
+		t.Fatalf("expected import to redirect, got %d", code)
+	}
+	if h, _ := db.History("foo"); len(h) != 1 || h[0].Who != "frew" {
+		t.Errorf("expected import to be recorded in history, got %+v", h)
+	}
+
+	code, h, body := c.do("GET", "/_export/?format=csv", nil)
+	if code != 200 || h.Get("Content-Type") != "text/csv" || !strings.Contains(body, "shortlink,foo,https://foo.com,,false,,,") {
+		t.Errorf("unexpected export: %d %s", code, body)
+	}
+}
+
+// userAuth authenticates everyone as itself.
+type userAuth string
+
+func (a userAuth) Wrap(h http.Handler) http.Handler   { return h }
+func (a userAuth) User(*http.Request) (string, error) { return string(a), nil }
+func (a userAuth) Name() string                       { return "user" }
+
+func TestTokens(t *testing.T) {
+	db := memstorage.New()
+	as := func(user string) *client {
+		c := newClient(t, shortlinks.Server{DB: db, Auth: userAuth(user), Admins: []string{"root"}}.Handler())
+		c.do("GET", "/_tokens/", nil)
+		return c
+	}
+	alice, bob, root := as("alice"), as("bob"), as("root")
+
+	mint := func(c *client, name, scope string) int {
+		code, _, _ := c.do("POST", "/_tokens/", url.Values{"csrf": {c.csrf()}, "action": {"create"}, "name": {name}, "scope": {scope}, "days": {"30"}})
+		return code
+	}
+	if code := mint(alice, "alice-ci", shortlinks.ScopeWrite); code != 200 {
+		t.Fatalf("expected alice to mint a write token, got %d", code)
+	}
+	if code := mint(bob, "bob-ci", shortlinks.ScopeAdmin); code != 403 {
+		t.Errorf("expected bob to be refused an admin token, got %d", code)
+	}
+	if code := mint(root, "root-ci", shortlinks.ScopeAdmin); code != 200 {
+		t.Errorf("expected root to mint an admin token, got %d", code)
+	}
+
+	if _, _, body := bob.do("GET", "/_tokens/", nil); strings.Contains(body, "alice-ci") || strings.Contains(body, `value="admin"`) {
+		t.Errorf("expected bob to see neither alice's token nor the admin scope: %s", body)
+	}
+	if _, _, body := root.do("GET", "/_tokens/", nil); !strings.Contains(body, "alice-ci") || !strings.Contains(body, `value="admin"`) {
+		t.Errorf("expected root to see alice's token and the admin scope: %s", body)
+	}
+
+	ts, _ := db.Tokens()
+	var id string
+	for _, tok := range ts {
+		if tok.Name == "alice-ci" {
+			id = tok.ID
+		}
+	}
+
+	revoke := func(c *client) int {
+		code, _, _ := c.do("POST", "/_tokens/", url.Values{"csrf": {c.csrf()}, "action": {"revoke"}, "id": {id}})
+		return code
+	}
+	if code := revoke(bob); code != 403 {
+		t.Errorf("expected bob to be refused revoking alice's token, got %d", code)
+	}
+	if ts, _ := db.Tokens(); len(ts) != 2 {
+		t.Errorf("expected alice's token to survive, got %+v", ts)
+	}
+	if code := revoke(root); code != 303 {
+		t.Errorf("expected root to revoke alice's token, got %d", code)
+	}
+	if ts, _ := db.Tokens(); len(ts) != 1 {
+		t.Errorf("expected alice's token to be revoked, got %+v", ts)
+	}
+
+	// A token only never expires if that's asked for.
+	for _, days := range []string{"", "0", "-1"} {
+		if code, _, _ := alice.do("POST", "/_tokens/", url.Values{"csrf": {alice.csrf()}, "action": {"create"}, "name": {"forever"}, "scope": {"read"}, "days": {days}}); code != 400 {
+			t.Errorf("expected days=%q to be refused, got %d", days, code)
+		}
+	}
+	if code, _, _ := alice.do("POST", "/_tokens/", url.Values{"csrf": {alice.csrf()}, "action": {"create"}, "name": {"forever"}, "scope": {"read"}, "never": {"1"}}); code != 200 {
+		t.Errorf("expected a token that never expires, got %d", code)
+	}
+	ts, _ = db.Tokens()
+	for _, tok := range ts {
+		if (tok.Name == "forever") != tok.Expires.IsZero() {
+			t.Errorf("expected only forever to never expire, got %+v", tok)
+		}
+	}
+}
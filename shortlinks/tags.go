@@ -0,0 +1,71 @@
+package shortlinks
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+var validTag = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]*$`)
+
+// ParseTags parses a comma or space separated list of tags, lower casing,
+// sorting and deduplicating them.  Tags are letters, digits, -, _ and ., so
+// that they can be used in URLs as they are.
+func ParseTags(s string) ([]string, error) {
+	tags := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool { return r == ',' || r == ' ' || r == '\t' || r == '\n' })
+	return NormalizeTags(tags)
+}
+
+// NormalizeTags lower cases, sorts and deduplicates tags, returning an error
+// if any are invalid.  It returns nil if there are no tags.
+func NormalizeTags(tags []string) ([]string, error) {
+	var ret []string
+	for _, t := range tags {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == "" {
+			continue
+		}
+		if !validTag.MatchString(t) {
+			return nil, fmt.Errorf("invalid tag %q: tags may only contain letters, digits, -, _ and .", t)
+		}
+		ret = append(ret, t)
+	}
+	sort.Strings(ret)
+	return slices.Compact(ret), nil
+}
+
+// TagCount is how many shortlinks have a tag.
+type TagCount struct {
+	Tag   string
+	Count int
+}
+
+// AllTags counts the tags of sls, ordered by tag.
+func AllTags(sls []Shortlink) []TagCount {
+	counts := map[string]int{}
+	for _, sl := range sls {
+		for _, t := range sl.Tags {
+			counts[t]++
+		}
+	}
+
+	ret := make([]TagCount, 0, len(counts))
+	for t, c := range counts {
+		ret = append(ret, TagCount{Tag: t, Count: c})
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Tag < ret[j].Tag })
+	return ret
+}
+
+// WithTag returns the shortlinks in sls tagged with tag.
+func WithTag(sls []Shortlink, tag string) []Shortlink {
+	ret := []Shortlink{}
+	for _, sl := range sls {
+		if slices.Contains(sl.Tags, tag) {
+			ret = append(ret, sl)
+		}
+	}
+	return ret
+}
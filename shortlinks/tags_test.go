@@ -0,0 +1,53 @@
+package shortlinks
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTags(t *testing.T) {
+	for _, test := range []struct {
+		s        string
+		expected []string
+		err      bool
+	}{
+		{s: "", expected: nil},
+		{s: "  , ", expected: nil},
+		{s: "eng", expected: []string{"eng"}},
+		{s: "Eng, docs ops,docs", expected: []string{"docs", "eng", "ops"}},
+		{s: "team-a v1.2 snake_case", expected: []string{"snake_case", "team-a", "v1.2"}},
+		{s: "a/b", err: true},
+		{s: "-leading", err: true},
+		{s: "émoji", err: true},
+	} {
+		got, err := ParseTags(test.s)
+		if test.err {
+			if err == nil {
+				t.Errorf("ParseTags(%q): expected error, got %v", test.s, got)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("ParseTags(%q): expected %v, got %v (%v)", test.s, test.expected, got, err)
+		}
+	}
+}
+
+func TestAllTags(t *testing.T) {
+	sls := []Shortlink{
+		{From: "a", Tags: []string{"eng", "ops"}},
+		{From: "b", Tags: []string{"eng"}},
+		{From: "c"},
+	}
+
+	if got := AllTags(sls); !reflect.DeepEqual(got, []TagCount{{"eng", 2}, {"ops", 1}}) {
+		t.Errorf("unexpected tag counts: %v", got)
+	}
+
+	if got := WithTag(sls, "eng"); len(got) != 2 || got[0].From != "a" || got[1].From != "b" {
+		t.Errorf("unexpected shortlinks tagged eng: %v", got)
+	}
+	if got := WithTag(sls, "nope"); len(got) != 0 {
+		t.Errorf("expected nothing tagged nope, got %v", got)
+	}
+}
@@ -3,6 +3,8 @@ package shortlinks
 import (
 	"embed"
 	"html/template"
+	"strings"
+	"time"
 )
 
 //go:embed templates/*
@@ -12,8 +14,21 @@ var tpl *template.Template
 
 func init() {
 	var err error
-	tpl, err = template.ParseFS(templates, "templates/*")
+	tpl, err = template.New("").Funcs(template.FuncMap{
+		"join": strings.Join,
+		"when": when,
+	}).ParseFS(templates, "templates/*")
 	if err != nil {
 		panic(err)
 	}
 }
+
+// when renders t as a <time>, in UTC until the script in z_footer.html
+// rewrites it in the viewer's locale.  The zero time is unknown.
+func when(t time.Time) template.HTML {
+	if t.IsZero() {
+		return "at an unknown time"
+	}
+	return template.HTML(`<time datetime="` + t.UTC().Format(time.RFC3339) + `">` +
+		t.UTC().Format("2006-01-02 15:04:05 UTC") + `</time>`)
+}
@@ -0,0 +1,121 @@
+package shortlinks
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+)
+
+// Token scopes.  Each scope implies the ones before it, so a write token can
+// also read, and an admin token can also write.
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+	ScopeAdmin = "admin"
+)
+
+var scopeLevel = map[string]int{ScopeRead: 1, ScopeWrite: 2, ScopeAdmin: 3}
+
+// tokenPrefix makes tokens easy to recognize, for example by secret scanners.
+const tokenPrefix = "sl_"
+
+// Token is an API token, used by automation to authenticate with an
+// Authorization: Bearer header.
+type Token struct {
+	// ID identifies the token for listing and revocation; it is not
+	// secret.
+	ID string
+
+	// Name describes what the token is for.
+	Name string
+
+	// Owner is the user that minted the token.
+	Owner string
+
+	// Hash is the output of HashToken on the secret.
+	Hash string
+
+	Scopes []string
+
+	Created time.Time
+
+	// Expires is when the token stops working; the zero value means never.
+	Expires time.Time
+}
+
+// NewToken mints a new token, returning the secret to hand to the user and
+// the Token to store.  A ttl of zero means the token never expires.
+func NewToken(name, owner string, scopes []string, ttl time.Duration) (string, Token) {
+	secret := tokenPrefix + randomString(32)
+
+	t := Token{
+		ID:      randomHex(8),
+		Name:    name,
+		Owner:   owner,
+		Hash:    HashToken(secret),
+		Scopes:  scopes,
+		Created: time.Now().UTC().Truncate(time.Second),
+	}
+	if ttl != 0 {
+		t.Expires = t.Created.Add(ttl)
+	}
+
+	return secret, t
+}
+
+type tokenKey struct{}
+
+// WithToken returns a copy of ctx recording that the request was
+// authenticated with t.  Auth drivers that accept tokens should use it so
+// that handlers can tell who owns the token and what it may do.
+func WithToken(ctx context.Context, t Token) context.Context {
+	return context.WithValue(ctx, tokenKey{}, t)
+}
+
+// TokenFrom returns the token recorded by WithToken, if any.
+func TokenFrom(ctx context.Context) (Token, bool) {
+	t, ok := ctx.Value(tokenKey{}).(Token)
+	return t, ok
+}
+
+// HashToken returns the representation of secret stored in the database.
+// Tokens are random enough that a plain SHA-256 is sufficient.
+func HashToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// HasScope returns true if t grants scope.
+func (t Token) HasScope(scope string) bool {
+	want := scopeLevel[scope]
+	for _, s := range t.Scopes {
+		if scopeLevel[s] >= want {
+			return true
+		}
+	}
+	return false
+}
+
+// Expired returns true if t has expired as of now.
+func (t Token) Expired(now time.Time) bool {
+	return !t.Expires.IsZero() && now.After(t.Expires)
+}
+
+func randomString(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
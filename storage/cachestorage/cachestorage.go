@@ -0,0 +1,217 @@
+// Package cachestorage provides drivers that cache shortlink lookups in memory.
+package cachestorage
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/frioux/shortlinks/shortlinks"
+)
+
+type Config struct {
+	// Size is the maximum number of shortlinks to cache; defaults to
+	// 1000.
+	Size int
+
+	// TTL is how long a found shortlink is cached; defaults to a minute.
+	TTL time.Duration
+
+	// NegativeTTL is how long a missing shortlink is cached; defaults to
+	// ten seconds.  Set it negative to not cache missing shortlinks.
+	NegativeTTL time.Duration
+}
+
+// Stats are counters describing how well the cache is working.
+type Stats struct {
+	Hits, Misses, Evictions uint64
+
+	// Size is the number of cached shortlinks, including missing ones.
+	Size int
+}
+
+// HitRate is the fraction of lookups served from the cache.
+func (s Stats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// PublicClient caches a shortlinks.PublicDB.
+type PublicClient struct {
+	db  shortlinks.PublicDB
+	cfg Config
+
+	// now is time.Now, overridden in tests.
+	now func() time.Time
+
+	mu    sync.Mutex
+	lru   *list.List
+	items map[string]*list.Element
+
+	// gen is incremented by every invalidation, so that a lookup that
+	// raced with a change doesn't cache the old value.
+	gen uint64
+
+	hits, misses, evictions atomic.Uint64
+}
+
+type entry struct {
+	from    string
+	sl      shortlinks.Shortlink
+	expires time.Time
+}
+
+// NewPublic returns a PublicClient caching db.
+func NewPublic(db shortlinks.PublicDB, c Config) *PublicClient {
+	if c.Size <= 0 {
+		c.Size = 1000
+	}
+	if c.TTL == 0 {
+		c.TTL = time.Minute
+	}
+	if c.NegativeTTL == 0 {
+		c.NegativeTTL = 10 * time.Second
+	}
+
+	return &PublicClient{
+		db:    db,
+		cfg:   c,
+		now:   time.Now,
+		lru:   list.New(),
+		items: map[string]*list.Element{},
+	}
+}
+
+func (c *PublicClient) Unwrap() shortlinks.PublicDB { return c.db }
+
+func (c *PublicClient) Shortlink(from string) (shortlinks.Shortlink, error) {
+	c.mu.Lock()
+	if el, ok := c.items[from]; ok {
+		e := el.Value.(*entry)
+		if c.now().Before(e.expires) {
+			c.lru.MoveToFront(el)
+			c.mu.Unlock()
+			c.hits.Add(1)
+			return e.sl, nil
+		}
+		c.remove(el)
+	}
+	gen := c.gen
+	c.mu.Unlock()
+
+	c.misses.Add(1)
+	sl, err := c.db.Shortlink(from)
+	if err != nil {
+		return sl, err
+	}
+
+	ttl := c.cfg.TTL
+	if sl.From == "" {
+		ttl = c.cfg.NegativeTTL
+	}
+	if ttl < 0 {
+		return sl, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if gen != c.gen {
+		return sl, nil
+	}
+	if el, ok := c.items[from]; ok {
+		c.remove(el)
+	}
+	c.items[from] = c.lru.PushFront(&entry{from: from, sl: sl, expires: c.now().Add(ttl)})
+	for c.lru.Len() > c.cfg.Size {
+		c.remove(c.lru.Back())
+		c.evictions.Add(1)
+	}
+
+	return sl, nil
+}
+
+func (c *PublicClient) AllShortlinks() ([]shortlinks.Shortlink, error) { return c.db.AllShortlinks() }
+
+// Invalidate forgets the cached value for from, if any.
+func (c *PublicClient) Invalidate(from string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	if el, ok := c.items[from]; ok {
+		c.remove(el)
+	}
+}
+
+// remove removes el from the cache.  The caller must hold the lock.
+func (c *PublicClient) remove(el *list.Element) {
+	c.lru.Remove(el)
+	delete(c.items, el.Value.(*entry).from)
+}
+
+func (c *PublicClient) Stats() Stats {
+	c.mu.Lock()
+	size := c.lru.Len()
+	c.mu.Unlock()
+
+	return Stats{
+		Hits:      c.hits.Load(),
+		Misses:    c.misses.Load(),
+		Evictions: c.evictions.Load(),
+		Size:      size,
+	}
+}
+
+// Client caches a shortlinks.DB, invalidating the cache when shortlinks are
+// changed through it.
+type Client struct {
+	*PublicClient
+
+	db shortlinks.DB
+}
+
+// New returns a Client caching db.
+func New(db shortlinks.DB, c Config) *Client {
+	return &Client{PublicClient: NewPublic(db, c), db: db}
+}
+
+func (c *Client) CreateShortlink(sl shortlinks.Shortlink) error {
+	defer c.Invalidate(sl.From)
+	return c.db.CreateShortlink(sl)
+}
+
+func (c *Client) DeleteShortlink(from, who, method string) error {
+	defer c.Invalidate(from)
+	return c.db.DeleteShortlink(from, who, method)
+}
+
+func (c *Client) History(from string) ([]shortlinks.History, error) { return c.db.History(from) }
+
+func (c *Client) InsertHistory(h shortlinks.History) error { return c.db.InsertHistory(h) }
+
+// LoadShortlink loads sl into the wrapped driver, which must be a
+// shortlinks.DBLoader.
+func (c *Client) LoadShortlink(sl shortlinks.Shortlink, deleted bool) error {
+	l, ok := shortlinks.As[shortlinks.DBLoader](c.db)
+	if !ok {
+		return fmt.Errorf("cachestorage: wrapped driver can't load: %w", errors.ErrUnsupported)
+	}
+	defer c.Invalidate(sl.From)
+	return l.LoadShortlink(sl, deleted)
+}
+
+// LoadHistory loads h into the wrapped driver, which must be a
+// shortlinks.DBLoader.
+func (c *Client) LoadHistory(h shortlinks.History) error {
+	l, ok := shortlinks.As[shortlinks.DBLoader](c.db)
+	if !ok {
+		return fmt.Errorf("cachestorage: wrapped driver can't load: %w", errors.ErrUnsupported)
+	}
+	return l.LoadHistory(h)
+}
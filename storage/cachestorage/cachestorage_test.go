@@ -0,0 +1,122 @@
+package cachestorage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/frioux/shortlinks/shortlinks"
+	"github.com/frioux/shortlinks/storage/memstorage"
+	"github.com/frioux/shortlinks/storage/storagetest"
+)
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) shortlinks.DB { return New(memstorage.New(), Config{}) })
+}
+
+// counting counts lookups that make it to the wrapped DB.
+type counting struct {
+	*memstorage.Client
+	lookups int
+}
+
+func (c *counting) Shortlink(from string) (shortlinks.Shortlink, error) {
+	c.lookups++
+	return c.Client.Shortlink(from)
+}
+
+func TestCache(t *testing.T) {
+	db := &counting{Client: memstorage.New()}
+	db.CreateShortlink(shortlinks.Shortlink{From: "a", To: "https://a.com"})
+
+	now := time.Now()
+	c := New(db, Config{Size: 2, TTL: time.Minute, NegativeTTL: time.Second})
+	c.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if sl, err := c.Shortlink("a"); err != nil || sl.To != "https://a.com" {
+			t.Fatalf("unexpected shortlink: %+v (%v)", sl, err)
+		}
+		if sl, _ := c.Shortlink("missing"); sl.From != "" {
+			t.Fatalf("unexpected shortlink: %+v", sl)
+		}
+	}
+	if db.lookups != 2 {
+		t.Errorf("expected 2 lookups, got %d", db.lookups)
+	}
+	if s := c.Stats(); s.Hits != 4 || s.Misses != 2 || s.Size != 2 {
+		t.Errorf("unexpected stats: %+v", s)
+	}
+
+	// Missing shortlinks expire sooner.
+	now = now.Add(2 * time.Second)
+	c.Shortlink("a")
+	c.Shortlink("missing")
+	if db.lookups != 3 {
+		t.Errorf("expected negative cache entry to expire, got %d lookups", db.lookups)
+	}
+
+	now = now.Add(2 * time.Minute)
+	c.Shortlink("a")
+	if db.lookups != 4 {
+		t.Errorf("expected cache entry to expire, got %d lookups", db.lookups)
+	}
+
+	// Changes through the cache are seen immediately.
+	if err := c.CreateShortlink(shortlinks.Shortlink{From: "missing", To: "https://found.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if sl, _ := c.Shortlink("missing"); sl.To != "https://found.com" {
+		t.Errorf("expected create to invalidate cache, got %+v", sl)
+	}
+	if err := c.DeleteShortlink("a", "frew", ""); err != nil {
+		t.Fatal(err)
+	}
+	if sl, _ := c.Shortlink("a"); sl.From != "" {
+		t.Errorf("expected delete to invalidate cache, got %+v", sl)
+	}
+
+	// The least recently used shortlink is evicted.
+	c.Shortlink("missing")
+	c.Shortlink("b")
+	before := db.lookups
+	c.Shortlink("missing")
+	c.Shortlink("a")
+	if db.lookups != before+1 {
+		t.Errorf("expected only a to have been evicted, got %d lookups", db.lookups-before)
+	}
+	if s := c.Stats(); s.Evictions == 0 || s.Size != 2 {
+		t.Errorf("unexpected stats: %+v", s)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	c := New(memstorage.New(), Config{})
+
+	if sl, _ := c.Shortlink("foo"); sl.From != "" {
+		t.Fatalf("unexpected shortlink: %+v", sl)
+	}
+
+	src := memstorage.New()
+	src.CreateShortlink(shortlinks.Shortlink{From: "foo", To: "https://foo.com"})
+	if _, err := shortlinks.Copy(c, src, shortlinks.CopyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if sl, _ := c.Shortlink("foo"); sl.To != "https://foo.com" {
+		t.Errorf("expected copying into the cache to invalidate it, got %+v", sl)
+	}
+
+	if l, ok := shortlinks.As[shortlinks.DBLoader](c); !ok || l != shortlinks.DBLoader(c) {
+		t.Error("expected the cache itself to be the DBLoader")
+	}
+}
+
+func TestAs(t *testing.T) {
+	c := New(memstorage.New(), Config{})
+
+	if _, ok := shortlinks.As[shortlinks.DBDeleted](c); !ok {
+		t.Error("expected to find DBDeleted through the cache")
+	}
+	if _, ok := shortlinks.As[shortlinks.DBTokens](NewPublic(memstorage.New(), Config{})); !ok {
+		t.Error("expected to find DBTokens through the public cache")
+	}
+}
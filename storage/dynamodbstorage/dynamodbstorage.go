@@ -9,12 +9,21 @@
 //
 // History (previous versions of shortlinks) have a `pk` of "h" with their From
 // value appended (ie the history of the "frew" shortlink has a `pk` of
-// "hfrew") and an `sk` of the RFC3339 representation of the time that history
-// was created.
+// "hfrew") and an `sk` of the time that history was created, in
+// shortlinks.WhenFormat so that it sorts.  History written by older versions
+// used time.Time.String, which doesn't; see Client.MigrateHistoryTimes.
+//
+// API tokens have a `pk` of "t" and an `sk` of the hash of the token.
+//
+// Hits (redirects to a shortlink) have a `pk` of "c" and an `sk` of the From
+// value, with the count in `n`.
 package dynamodbstorage
 
 import (
 	"context"
+	"fmt"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -27,8 +36,10 @@ import (
 )
 
 const (
-	pkShortlink = "s"
+	pkShortlink        = "s"
 	pkDeletedShortlink = "d"
+	pkToken            = "t"
+	pkHits             = "c"
 )
 
 type Client struct {
@@ -44,6 +55,67 @@ type shortlink struct {
 	To   string `dynamodbav:"to,omitempty"`
 
 	Description string `dynamodbav:"d,omitempty"`
+
+	// Tags are a string set, so they have to be sorted when read.
+	Tags []string `dynamodbav:"tags,stringset,omitempty"`
+
+	// CreatedAt and UpdatedAt are in shortlinks.WhenFormat, or empty if
+	// unset.
+	CreatedAt string `dynamodbav:"ca,omitempty"`
+	CreatedBy string `dynamodbav:"cb,omitempty"`
+	UpdatedAt string `dynamodbav:"ua,omitempty"`
+	UpdatedBy string `dynamodbav:"ub,omitempty"`
+}
+
+func newShortlink(pk string, sl shortlinks.Shortlink) shortlink {
+	return shortlink{
+		PK:   pk,
+		From: sl.From,
+		To:   sl.To,
+
+		Description: sl.Description,
+		Tags:        sl.Tags,
+
+		CreatedAt: formatTime(sl.CreatedAt),
+		CreatedBy: sl.CreatedBy,
+		UpdatedAt: formatTime(sl.UpdatedAt),
+		UpdatedBy: sl.UpdatedBy,
+	}
+}
+
+func (s shortlink) shortlink() shortlinks.Shortlink {
+	return shortlinks.Shortlink{
+		From: s.From,
+		To:   s.To,
+
+		Description: s.Description,
+		Tags:        sorted(s.Tags),
+
+		CreatedAt: parseTime(s.CreatedAt),
+		CreatedBy: s.CreatedBy,
+		UpdatedAt: parseTime(s.UpdatedAt),
+		UpdatedBy: s.UpdatedBy,
+	}
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return shortlinks.FormatWhen(t)
+}
+
+func parseTime(s string) time.Time {
+	t, _ := time.Parse(time.RFC3339Nano, s)
+	return t
+}
+
+func sorted(tags []string) []string {
+	if len(tags) == 0 {
+		return nil
+	}
+	sort.Strings(tags)
+	return tags
 }
 
 func mustMarshal(v interface{}) map[string]types.AttributeValue {
@@ -73,24 +145,29 @@ func (cl *Client) Shortlink(from string) (shortlinks.Shortlink, error) {
 	var s shortlink
 	mustUnmarshal(gio.Item, &s)
 
-	return shortlinks.Shortlink{
-		From: s.From,
-		To:   s.To,
-
-		Description: s.Description,
-	}, nil
+	return s.shortlink(), nil
 }
 
 func (cl *Client) CreateShortlink(sl shortlinks.Shortlink) error {
+	old, err := cl.Shortlink(sl.From)
+	if err != nil {
+		return err
+	}
+	if old.From != "" {
+		sl.CreatedAt, sl.CreatedBy = old.CreatedAt, old.CreatedBy
+	}
+
 	if _, err := cl.DB.PutItem(context.Background(), &dynamodb.PutItemInput{
 		TableName: aws.String(cl.Table),
-		Item: mustMarshal(shortlink{
-			PK:   pkShortlink,
-			From: sl.From,
-			To:   sl.To,
+		Item:      mustMarshal(newShortlink(pkShortlink, sl)),
+	}); err != nil {
+		return err
+	}
 
-			Description: sl.Description,
-		}),
+	// Creating a deleted shortlink restores it.
+	if _, err := cl.DB.DeleteItem(context.Background(), &dynamodb.DeleteItemInput{
+		TableName: aws.String(cl.Table),
+		Key:       mustMarshal(shortlink{PK: pkDeletedShortlink, From: sl.From}),
 	}); err != nil {
 		return err
 	}
@@ -118,12 +195,7 @@ func (cl *Client) pkShortlinks(pk string) ([]shortlinks.Shortlink, error) {
 		for _, itm := range o.Items {
 			var s shortlink
 			mustUnmarshal(itm, &s)
-			ret = append(ret, shortlinks.Shortlink{
-				From: s.From,
-				To:   s.To,
-
-				Description: s.Description,
-			})
+			ret = append(ret, s.shortlink())
 		}
 	}
 
@@ -132,31 +204,118 @@ func (cl *Client) pkShortlinks(pk string) ([]shortlinks.Shortlink, error) {
 
 func (cl *Client) AllShortlinks() ([]shortlinks.Shortlink, error) { return cl.pkShortlinks(pkShortlink) }
 
-func (cl *Client) DeleteShortlink(from, who string) error {
+// ShortlinksPage loads a single page of the query; the next page starts after
+// its LastEvaluatedKey, so the last page may be empty.
+func (cl *Client) ShortlinksPage(after string, limit int) ([]shortlinks.Shortlink, string, error) {
+	qi := &dynamodb.QueryInput{
+		TableName:              aws.String(cl.Table),
+		KeyConditionExpression: aws.String("pk = :pk"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk": &types.AttributeValueMemberS{Value: pkShortlink},
+		},
+		Limit: aws.Int32(int32(limit)),
+	}
+	if after != "" {
+		qi.ExclusiveStartKey = startKey(after)
+	}
+
+	o, err := dynamodb.NewQueryPaginator(cl.DB, qi).NextPage(context.Background())
+	if err != nil {
+		return nil, "", err
+	}
+
+	ret := make([]shortlinks.Shortlink, 0, len(o.Items))
+	for _, itm := range o.Items {
+		var s shortlink
+		mustUnmarshal(itm, &s)
+		ret = append(ret, s.shortlink())
+	}
+
+	var next shortlink
+	if o.LastEvaluatedKey != nil {
+		mustUnmarshal(o.LastEvaluatedKey, &next)
+	}
+
+	return ret, next.From, nil
+}
+
+// ShortlinksPageByAuthor filters by author, which DynamoDB does after reading
+// each page of the query, so it keeps reading until it has limit shortlinks or
+// there are no more.
+func (cl *Client) ShortlinksPageByAuthor(author, after string, limit int) ([]shortlinks.Shortlink, string, error) {
+	qi := &dynamodb.QueryInput{
+		TableName:              aws.String(cl.Table),
+		KeyConditionExpression: aws.String("pk = :pk"),
+		FilterExpression:       aws.String("cb = :a OR ub = :a"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk": &types.AttributeValueMemberS{Value: pkShortlink},
+			":a":  &types.AttributeValueMemberS{Value: author},
+		},
+	}
+	if after != "" {
+		qi.ExclusiveStartKey = startKey(after)
+	}
+
+	ret := make([]shortlinks.Shortlink, 0, limit)
+	for {
+		// Limit is how many items are read, before filtering, so this
+		// never returns more than limit.
+		qi.Limit = aws.Int32(int32(limit - len(ret)))
+		o, err := cl.DB.Query(context.Background(), qi)
+		if err != nil {
+			return nil, "", err
+		}
+
+		for _, itm := range o.Items {
+			var s shortlink
+			mustUnmarshal(itm, &s)
+			ret = append(ret, s.shortlink())
+		}
+
+		if o.LastEvaluatedKey == nil {
+			return ret, "", nil
+		}
+		if len(ret) == limit {
+			var next shortlink
+			mustUnmarshal(o.LastEvaluatedKey, &next)
+			return ret, next.From, nil
+		}
+		qi.ExclusiveStartKey = o.LastEvaluatedKey
+	}
+}
+
+// startKey is the ExclusiveStartKey to query shortlinks after after.
+func startKey(after string) map[string]types.AttributeValue {
+	return mustMarshal(struct {
+		PK   string `dynamodbav:"pk"`
+		From string `dynamodbav:"sk"`
+	}{pkShortlink, after})
+}
+
+func (cl *Client) DeleteShortlink(from, who, method string) error {
 	sl, err := cl.Shortlink(from)
 	if err != nil {
 		return err
 	}
+	if sl.From == "" {
+		return nil
+	}
 
 	if err := cl.InsertHistory(shortlinks.History{
 		From: from,
 		To:   sl.To,
 		Who:  who,
 
-		Description: "«deleted»",
+		Method:      method,
+		Description: shortlinks.DeletedDescription,
+		Tags:        sl.Tags,
 	}); err != nil {
 		return err
 	}
 
 	if _, err := cl.DB.PutItem(context.Background(), &dynamodb.PutItemInput{
 		TableName: aws.String(cl.Table),
-		Item: mustMarshal(shortlink{
-			PK:   pkDeletedShortlink,
-			From: sl.From,
-			To:   sl.To,
-
-			Description: sl.Description,
-		}),
+		Item:      mustMarshal(newShortlink(pkDeletedShortlink, sl)),
 	}); err != nil {
 		return err
 	}
@@ -178,12 +337,17 @@ type history struct {
 	// PK is h (for history) followed by the From value
 	PK string `dynamodbav:"pk"`
 
-	// When is the sk (RFC3339)
+	// When is the sk, in shortlinks.WhenFormat.
 	When string `dynamodbav:"sk"`
 	Who  string `dynamodbav:"who"`
 	To   string `dynamodbav:"to,omitempty"`
 
 	Description string `dynamodbav:"d,omitempty"`
+
+	// Method is the auth method used to make the change.
+	Method string `dynamodbav:"m,omitempty"`
+
+	Tags []string `dynamodbav:"tags,stringset,omitempty"`
 }
 
 func (h history) From() string {
@@ -210,13 +374,19 @@ func (cl *Client) History(from string) ([]shortlinks.History, error) {
 		for _, itm := range o.Items {
 			var h history
 			mustUnmarshal(itm, &h)
+			// ParseWhen so that history that hasn't been migrated yet
+			// still loads, and anything it can't parse is an unknown
+			// (zero) time rather than an error for the whole history.
+			when, _ := shortlinks.ParseWhen(h.When)
 			ret = append(ret, shortlinks.History{
 				From: h.From(),
 				To:   h.To,
-				When: h.When,
+				When: when,
 				Who:  h.Who,
 
+				Method:      h.Method,
 				Description: h.Description,
+				Tags:        sorted(h.Tags),
 			})
 		}
 	}
@@ -229,11 +399,108 @@ func (cl *Client) InsertHistory(h shortlinks.History) error {
 		TableName: aws.String(cl.Table),
 		Item: mustMarshal(history{
 			PK:   "h" + h.From,
-			When: time.Now().String(),
+			When: shortlinks.FormatWhen(time.Now()),
+			Who:  h.Who,
+			To:   h.To,
+
+			Method:      h.Method,
+			Description: h.Description,
+			Tags:        h.Tags,
+		}),
+	}); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// MigrateHistoryTimes rewrites history with an sk in any format but
+// shortlinks.WhenFormat, like the time.Time.String used by older versions, so
+// that history sorts by time.  It returns how many items were (or with dryRun,
+// would be) rewritten.  Running it again only rewrites what's left.
+func (cl *Client) MigrateHistoryTimes(ctx context.Context, dryRun bool) (int, error) {
+	pager := dynamodb.NewScanPaginator(cl.DB, &dynamodb.ScanInput{
+		TableName:        aws.String(cl.Table),
+		FilterExpression: aws.String("begins_with(pk, :h)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":h": &types.AttributeValueMemberS{Value: "h"},
+		},
+	})
+
+	var n int
+	for pager.HasMorePages() {
+		o, err := pager.NextPage(ctx)
+		if err != nil {
+			return n, err
+		}
+
+		for _, itm := range o.Items {
+			var h history
+			mustUnmarshal(itm, &h)
+			when, err := shortlinks.ParseWhen(h.When)
+			if err != nil {
+				return n, fmt.Errorf("history for %s: %w", h.From(), err)
+			}
+			if shortlinks.FormatWhen(when) == h.When {
+				continue
+			}
+
+			n++
+			if dryRun {
+				continue
+			}
+
+			old := map[string]types.AttributeValue{"pk": itm["pk"], "sk": itm["sk"]}
+			itm["sk"] = &types.AttributeValueMemberS{Value: shortlinks.FormatWhen(when)}
+			if _, err := cl.DB.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+				TransactItems: []types.TransactWriteItem{
+					{Put: &types.Put{TableName: aws.String(cl.Table), Item: itm}},
+					{Delete: &types.Delete{TableName: aws.String(cl.Table), Key: old}},
+				},
+			}); err != nil {
+				return n, fmt.Errorf("history for %s: %w", h.From(), err)
+			}
+		}
+	}
+
+	return n, nil
+}
+
+func (cl *Client) LoadShortlink(sl shortlinks.Shortlink, deleted bool) error {
+	pk, other := pkShortlink, pkDeletedShortlink
+	if deleted {
+		pk, other = other, pk
+	}
+
+	if _, err := cl.DB.PutItem(context.Background(), &dynamodb.PutItemInput{
+		TableName: aws.String(cl.Table),
+		Item:      mustMarshal(newShortlink(pk, sl)),
+	}); err != nil {
+		return err
+	}
+
+	if _, err := cl.DB.DeleteItem(context.Background(), &dynamodb.DeleteItemInput{
+		TableName: aws.String(cl.Table),
+		Key:       mustMarshal(shortlink{PK: other, From: sl.From}),
+	}); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (cl *Client) LoadHistory(h shortlinks.History) error {
+	if _, err := cl.DB.PutItem(context.Background(), &dynamodb.PutItemInput{
+		TableName: aws.String(cl.Table),
+		Item: mustMarshal(history{
+			PK:   "h" + h.From,
+			When: shortlinks.FormatWhen(h.When),
 			Who:  h.Who,
 			To:   h.To,
 
+			Method:      h.Method,
 			Description: h.Description,
+			Tags:        h.Tags,
 		}),
 	}); err != nil {
 		return err
@@ -241,3 +508,183 @@ func (cl *Client) InsertHistory(h shortlinks.History) error {
 
 	return nil
 }
+
+type token struct {
+	// PK is hardcoded to t for tokens.
+	PK   string `dynamodbav:"pk"`
+	Hash string `dynamodbav:"sk"`
+
+	ID     string   `dynamodbav:"id"`
+	Name   string   `dynamodbav:"name"`
+	Owner  string   `dynamodbav:"owner,omitempty"`
+	Scopes []string `dynamodbav:"scopes,stringset"`
+
+	// Created and Expires are unix seconds; an Expires of 0 means never.
+	Created int64 `dynamodbav:"created"`
+	Expires int64 `dynamodbav:"expires,omitempty"`
+}
+
+type tokenKey struct {
+	PK   string `dynamodbav:"pk"`
+	Hash string `dynamodbav:"sk"`
+}
+
+func (t token) token() shortlinks.Token {
+	ret := shortlinks.Token{
+		ID:      t.ID,
+		Name:    t.Name,
+		Owner:   t.Owner,
+		Hash:    t.Hash,
+		Scopes:  t.Scopes,
+		Created: time.Unix(t.Created, 0).UTC(),
+	}
+	if t.Expires != 0 {
+		ret.Expires = time.Unix(t.Expires, 0).UTC()
+	}
+	return ret
+}
+
+func (cl *Client) CreateToken(t shortlinks.Token) error {
+	tok := token{
+		PK:      pkToken,
+		Hash:    t.Hash,
+		ID:      t.ID,
+		Name:    t.Name,
+		Owner:   t.Owner,
+		Scopes:  t.Scopes,
+		Created: t.Created.Unix(),
+	}
+	if !t.Expires.IsZero() {
+		tok.Expires = t.Expires.Unix()
+	}
+
+	if _, err := cl.DB.PutItem(context.Background(), &dynamodb.PutItemInput{
+		TableName: aws.String(cl.Table),
+		Item:      mustMarshal(tok),
+	}); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (cl *Client) TokenByHash(hash string) (shortlinks.Token, error) {
+	gio, err := cl.DB.GetItem(context.Background(), &dynamodb.GetItemInput{
+		TableName: aws.String(cl.Table),
+		Key:       mustMarshal(tokenKey{PK: pkToken, Hash: hash}),
+	})
+	if err != nil {
+		return shortlinks.Token{}, err
+	}
+	if gio.Item == nil {
+		return shortlinks.Token{}, nil
+	}
+
+	var t token
+	mustUnmarshal(gio.Item, &t)
+
+	return t.token(), nil
+}
+
+func (cl *Client) Tokens() ([]shortlinks.Token, error) {
+	qi := &dynamodb.QueryInput{
+		TableName:              aws.String(cl.Table),
+		KeyConditionExpression: aws.String("pk = :pk"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk": &types.AttributeValueMemberS{Value: pkToken},
+		},
+	}
+	pager := dynamodb.NewQueryPaginator(cl.DB, qi)
+
+	ret := make([]shortlinks.Token, 0, 10)
+	for pager.HasMorePages() {
+		o, err := pager.NextPage(context.Background())
+		if err != nil {
+			return nil, err
+		}
+
+		for _, itm := range o.Items {
+			var t token
+			mustUnmarshal(itm, &t)
+			ret = append(ret, t.token())
+		}
+	}
+
+	return ret, nil
+}
+
+// RevokeToken has to find the token by scanning them all, since tokens are
+// keyed by their hash.  There shouldn't be many.
+func (cl *Client) RevokeToken(id string) error {
+	ts, err := cl.Tokens()
+	if err != nil {
+		return err
+	}
+
+	for _, t := range ts {
+		if t.ID != id {
+			continue
+		}
+		if _, err := cl.DB.DeleteItem(context.Background(), &dynamodb.DeleteItemInput{
+			TableName: aws.String(cl.Table),
+			Key:       mustMarshal(tokenKey{PK: pkToken, Hash: t.Hash}),
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type hits struct {
+	// PK is hardcoded to c for hits.
+	PK   string `dynamodbav:"pk"`
+	From string `dynamodbav:"sk"`
+	N    int    `dynamodbav:"n"`
+}
+
+func (cl *Client) AddHits(from string, n int) error {
+	if _, err := cl.DB.UpdateItem(context.Background(), &dynamodb.UpdateItemInput{
+		TableName:        aws.String(cl.Table),
+		Key:              mustMarshal(shortlink{PK: pkHits, From: from}),
+		UpdateExpression: aws.String("ADD n :n"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":n": &types.AttributeValueMemberN{Value: strconv.Itoa(n)},
+		},
+	}); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Hits loads every count.  Client isn't a shortlinks.DBPopularPager, because
+// ordering shortlinks by hits would need a global secondary index on n, and
+// even then the hits and shortlinks are separate items that would have to be
+// joined; the index sorted by popularity loads every shortlink instead.
+func (cl *Client) Hits() (map[string]int, error) {
+	qi := &dynamodb.QueryInput{
+		TableName:              aws.String(cl.Table),
+		KeyConditionExpression: aws.String("pk = :pk"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk": &types.AttributeValueMemberS{Value: pkHits},
+		},
+	}
+	pager := dynamodb.NewQueryPaginator(cl.DB, qi)
+
+	ret := map[string]int{}
+	for pager.HasMorePages() {
+		o, err := pager.NextPage(context.Background())
+		if err != nil {
+			return nil, err
+		}
+
+		for _, itm := range o.Items {
+			var h hits
+			mustUnmarshal(itm, &h)
+			ret[h.From] = h.N
+		}
+	}
+
+	return ret, nil
+}
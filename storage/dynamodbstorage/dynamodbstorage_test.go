@@ -0,0 +1,104 @@
+package dynamodbstorage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/frioux/shortlinks/shortlinks"
+	"github.com/frioux/shortlinks/storage/storagetest"
+)
+
+// connect creates a fresh table in the DynamoDB Local at
+// SHORTLINKS_DYNAMODB_ENDPOINT, eg:
+//
+//	docker run -p 8000:8000 amazon/dynamodb-local
+//	SHORTLINKS_DYNAMODB_ENDPOINT=http://localhost:8000 go test ./storage/dynamodbstorage
+func connect(t *testing.T) *Client {
+	endpoint := os.Getenv("SHORTLINKS_DYNAMODB_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("SHORTLINKS_DYNAMODB_ENDPOINT not set")
+	}
+
+	svc := dynamodb.New(dynamodb.Options{
+		Region:       "us-west-2",
+		BaseEndpoint: aws.String(endpoint),
+		Credentials: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "local", SecretAccessKey: "local"}, nil
+		}),
+	})
+
+	b := make([]byte, 8)
+	rand.Read(b)
+	table := "shortlinks-test-" + hex.EncodeToString(b)
+
+	if _, err := svc.CreateTable(context.Background(), &dynamodb.CreateTableInput{
+		TableName:   aws.String(table),
+		BillingMode: types.BillingModePayPerRequest,
+		AttributeDefinitions: []types.AttributeDefinition{
+			{AttributeName: aws.String("pk"), AttributeType: types.ScalarAttributeTypeS},
+			{AttributeName: aws.String("sk"), AttributeType: types.ScalarAttributeTypeS},
+		},
+		KeySchema: []types.KeySchemaElement{
+			{AttributeName: aws.String("pk"), KeyType: types.KeyTypeHash},
+			{AttributeName: aws.String("sk"), KeyType: types.KeyTypeRange},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		svc.DeleteTable(context.Background(), &dynamodb.DeleteTableInput{TableName: aws.String(table)})
+	})
+
+	return &Client{DB: svc, Table: table}
+}
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) shortlinks.DB { return connect(t) })
+}
+
+func TestMigrateHistoryTimes(t *testing.T) {
+	c := connect(t)
+
+	// As written by older versions, which sort by the wall clock in the
+	// local zone rather than by time.
+	for _, when := range []time.Time{
+		time.Date(2024, 1, 2, 3, 4, 5, 0, time.FixedZone("PST", -8*60*60)),
+		time.Date(2024, 1, 2, 9, 4, 5, 0, time.UTC),
+	} {
+		if _, err := c.DB.PutItem(context.Background(), &dynamodb.PutItemInput{
+			TableName: aws.String(c.Table),
+			Item:      mustMarshal(history{PK: "ha", When: when.String(), Who: "frew", To: "https://a.com"}),
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.InsertHistory(shortlinks.History{From: "a", To: "https://a.org"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := c.MigrateHistoryTimes(context.Background(), true); err != nil || n != 2 {
+		t.Fatalf("expected dry run to find 2 items, got %d (%v)", n, err)
+	}
+	if n, err := c.MigrateHistoryTimes(context.Background(), false); err != nil || n != 2 {
+		t.Fatalf("expected 2 items to be migrated, got %d (%v)", n, err)
+	}
+	if n, err := c.MigrateHistoryTimes(context.Background(), false); err != nil || n != 0 {
+		t.Errorf("expected nothing left to migrate, got %d (%v)", n, err)
+	}
+
+	h, err := c.History("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(h) != 3 || !h[0].When.Equal(time.Date(2024, 1, 2, 9, 4, 5, 0, time.UTC)) || !h[1].When.Equal(time.Date(2024, 1, 2, 11, 4, 5, 0, time.UTC)) || h[2].To != "https://a.org" {
+		t.Errorf("expected history in order, got %+v", h)
+	}
+}
@@ -0,0 +1,369 @@
+// Package memstorage provides a client for storing shortlinks in memory.
+package memstorage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/frioux/shortlinks/shortlinks"
+)
+
+type Client struct {
+	mu   sync.RWMutex
+	path string
+	data data
+
+	// dirty is set when data has changed since the last snapshot without
+	// taking one; see AddHits and LoadShortlink.
+	dirty bool
+}
+
+// data is everything stored by the Client, and the format of snapshots.
+type data struct {
+	Shortlinks map[string]shortlinks.Shortlink
+	Deleted    map[string]shortlinks.Shortlink
+	History    map[string][]history
+
+	// Tokens are keyed by hash.
+	Tokens map[string]shortlinks.Token
+
+	Hits map[string]int
+}
+
+// history is shortlinks.History as it's snapshotted, with When as a string so
+// that snapshots from before it was a time.Time still load.
+type history struct {
+	shortlinks.History
+	When string
+}
+
+func newHistory(h shortlinks.History) history {
+	h.When = h.When.UTC()
+	h.Tags = slices.Clone(h.Tags)
+	return history{History: h, When: shortlinks.FormatWhen(h.When)}
+}
+
+// New returns an empty Client that only stores data in memory.
+func New() *Client {
+	c := &Client{}
+	c.init()
+	return c
+}
+
+// Open returns a Client that loads its data from the snapshot at path, if
+// it exists, and rewrites the snapshot after every change but hits and loads;
+// see AddHits and LoadShortlink.
+func Open(path string) (*Client, error) {
+	c := &Client{path: path}
+
+	b, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(b, &c.data); err != nil {
+			return nil, fmt.Errorf("couldn't load snapshot (%s): %w", path, err)
+		}
+		for _, hs := range c.data.History {
+			for i := range hs {
+				if hs[i].History.When, err = shortlinks.ParseWhen(hs[i].When); err != nil {
+					return nil, fmt.Errorf("couldn't load snapshot (%s): %w", path, err)
+				}
+			}
+		}
+	}
+	c.init()
+
+	return c, nil
+}
+
+func (c *Client) init() {
+	if c.data.Shortlinks == nil {
+		c.data.Shortlinks = map[string]shortlinks.Shortlink{}
+	}
+	if c.data.Deleted == nil {
+		c.data.Deleted = map[string]shortlinks.Shortlink{}
+	}
+	if c.data.History == nil {
+		c.data.History = map[string][]history{}
+	}
+	if c.data.Tokens == nil {
+		c.data.Tokens = map[string]shortlinks.Token{}
+	}
+	if c.data.Hits == nil {
+		c.data.Hits = map[string]int{}
+	}
+}
+
+// snapshot writes the data to c.path, if set.  The caller must hold the
+// lock.
+func (c *Client) snapshot() error {
+	if c.path == "" {
+		return nil
+	}
+
+	b, err := json.Marshal(c.data)
+	if err != nil {
+		return err
+	}
+
+	// Write and rename so that a crash never leaves a partial snapshot.
+	f, err := os.CreateTemp(filepath.Dir(c.path), ".memstorage-*")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), c.path); err != nil {
+		return fmt.Errorf("couldn't write snapshot (%s): %w", c.path, err)
+	}
+	c.dirty = false
+
+	return nil
+}
+
+// Close writes any changes that haven't been snapshotted yet.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.dirty {
+		return nil
+	}
+	return c.snapshot()
+}
+
+func (c *Client) Shortlink(from string) (shortlinks.Shortlink, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return clone(c.data.Shortlinks[from]), nil
+}
+
+func (c *Client) AllShortlinks() ([]shortlinks.Shortlink, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return sorted(c.data.Shortlinks), nil
+}
+
+func (c *Client) ShortlinksPage(after string, limit int) ([]shortlinks.Shortlink, string, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	all := sorted(c.data.Shortlinks)
+	i := sort.Search(len(all), func(i int) bool { return all[i].From > after })
+	ret, next := shortlinks.Page(all[i:], limit)
+	return ret, next, nil
+}
+
+func (c *Client) ShortlinksPageByAuthor(author, after string, limit int) ([]shortlinks.Shortlink, string, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var by []shortlinks.Shortlink
+	for _, sl := range sorted(c.data.Shortlinks) {
+		if sl.From > after && (sl.CreatedBy == author || sl.UpdatedBy == author) {
+			by = append(by, sl)
+		}
+	}
+	ret, next := shortlinks.Page(by, limit)
+	return ret, next, nil
+}
+
+func (c *Client) DeletedShortlinks() ([]shortlinks.Shortlink, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return sorted(c.data.Deleted), nil
+}
+
+func sorted(m map[string]shortlinks.Shortlink) []shortlinks.Shortlink {
+	ret := make([]shortlinks.Shortlink, 0, len(m))
+	for _, sl := range m {
+		ret = append(ret, clone(sl))
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].From < ret[j].From })
+	return ret
+}
+
+// clone copies sl's Tags, so that callers can't change what is stored through
+// them, nor the other way around.
+func clone(sl shortlinks.Shortlink) shortlinks.Shortlink {
+	sl.Tags = slices.Clone(sl.Tags)
+	return sl
+}
+
+func (c *Client) CreateShortlink(sl shortlinks.Shortlink) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	sl = clone(sl)
+	if old, ok := c.data.Shortlinks[sl.From]; ok {
+		sl.CreatedAt, sl.CreatedBy = old.CreatedAt, old.CreatedBy
+	}
+	c.data.Shortlinks[sl.From] = sl
+	delete(c.data.Deleted, sl.From)
+
+	return c.snapshot()
+}
+
+func (c *Client) DeleteShortlink(from, who, method string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	sl, ok := c.data.Shortlinks[from]
+	if !ok {
+		return nil
+	}
+
+	c.insertHistory(shortlinks.History{From: from, To: sl.To, Who: who, Method: method, Description: shortlinks.DeletedDescription, Tags: sl.Tags})
+	c.data.Deleted[from] = sl
+	delete(c.data.Shortlinks, from)
+
+	return c.snapshot()
+}
+
+func (c *Client) History(from string) ([]shortlinks.History, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	ret := make([]shortlinks.History, len(c.data.History[from]))
+	for i, h := range c.data.History[from] {
+		ret[i] = h.History
+		ret[i].Tags = slices.Clone(h.Tags)
+	}
+	return ret, nil
+}
+
+func (c *Client) InsertHistory(h shortlinks.History) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.insertHistory(h)
+
+	return c.snapshot()
+}
+
+func (c *Client) insertHistory(h shortlinks.History) {
+	h.When = time.Now()
+	c.data.History[h.From] = append(c.data.History[h.From], newHistory(h))
+}
+
+// LoadShortlink and LoadHistory don't snapshot, so that copying into a
+// Client isn't quadratic; the data is saved with the next change, or by Close.
+func (c *Client) LoadShortlink(sl shortlinks.Shortlink, deleted bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	sl = clone(sl)
+	if deleted {
+		c.data.Deleted[sl.From] = sl
+		delete(c.data.Shortlinks, sl.From)
+	} else {
+		c.data.Shortlinks[sl.From] = sl
+		delete(c.data.Deleted, sl.From)
+	}
+	c.dirty = true
+
+	return nil
+}
+
+func (c *Client) LoadHistory(h shortlinks.History) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.data.History[h.From] = append(c.data.History[h.From], newHistory(h))
+	c.dirty = true
+
+	return nil
+}
+
+// AddHits doesn't snapshot, since hits change on every redirect; they are
+// saved with the next change, or by Close.
+func (c *Client) AddHits(from string, n int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.data.Hits[from] += n
+	c.dirty = true
+
+	return nil
+}
+
+func (c *Client) Hits() (map[string]int, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return maps.Clone(c.data.Hits), nil
+}
+
+func (c *Client) ShortlinksPageByHits(offset, limit int) ([]shortlinks.Shortlink, bool, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	all := sorted(c.data.Shortlinks)
+	sort.SliceStable(all, func(i, j int) bool { return c.data.Hits[all[i].From] > c.data.Hits[all[j].From] })
+	all = all[min(offset, len(all)):]
+	if len(all) > limit {
+		return all[:limit], true, nil
+	}
+	return all, false, nil
+}
+
+func (c *Client) CreateToken(t shortlinks.Token) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.data.Tokens[t.Hash] = t
+
+	return c.snapshot()
+}
+
+func (c *Client) TokenByHash(hash string) (shortlinks.Token, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.data.Tokens[hash], nil
+}
+
+func (c *Client) Tokens() ([]shortlinks.Token, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	ret := make([]shortlinks.Token, 0, len(c.data.Tokens))
+	for _, t := range c.data.Tokens {
+		ret = append(ret, t)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Created.Before(ret[j].Created) })
+	return ret, nil
+}
+
+func (c *Client) RevokeToken(id string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for h, t := range c.data.Tokens {
+		if t.ID == id {
+			delete(c.data.Tokens, h)
+		}
+	}
+
+	return c.snapshot()
+}
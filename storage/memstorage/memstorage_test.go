@@ -0,0 +1,166 @@
+package memstorage
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/frioux/shortlinks/shortlinks"
+	"github.com/frioux/shortlinks/storage/storagetest"
+)
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) shortlinks.DB { return New() })
+}
+
+func TestSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+
+	c, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.CreateShortlink(shortlinks.Shortlink{From: "a", To: "https://a.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.CreateShortlink(shortlinks.Shortlink{From: "b", To: "https://b.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.InsertHistory(shortlinks.History{From: "a", To: "https://a.com", Who: "frew"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DeleteShortlink("b", "frew", ""); err != nil {
+		t.Fatal(err)
+	}
+	_, tok := shortlinks.NewToken("ci", "frew", []string{shortlinks.ScopeRead}, time.Hour)
+	if err := c.CreateToken(tok); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.AddHits("a", 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sl, _ := c.Shortlink("a"); sl.To != "https://a.com" {
+		t.Errorf("expected a to survive snapshot, got %+v", sl)
+	}
+	if del, _ := c.DeletedShortlinks(); len(del) != 1 || del[0].From != "b" {
+		t.Errorf("expected b to be deleted, got %+v", del)
+	}
+	if h, _ := c.History("a"); len(h) != 1 || h[0].Who != "frew" {
+		t.Errorf("unexpected history: %+v", h)
+	}
+	if got, _ := c.TokenByHash(tok.Hash); got.ID != tok.ID || !got.Expires.Equal(tok.Expires) {
+		t.Errorf("unexpected token: %+v", got)
+	}
+	if hits, _ := c.Hits(); hits["a"] != 2 {
+		t.Errorf("expected hits to be saved on close, got %v", hits)
+	}
+}
+
+// TestLoadSnapshot makes sure loads are only snapshotted on Close.
+func TestLoadSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+
+	c, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.LoadShortlink(shortlinks.Shortlink{From: "a", To: "https://a.com"}, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.LoadHistory(shortlinks.History{From: "a", To: "https://a.com", Who: "frew"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); err == nil {
+		t.Error("expected loads not to snapshot")
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sl, _ := c.Shortlink("a"); sl.To != "https://a.com" {
+		t.Errorf("expected a to be saved on close, got %+v", sl)
+	}
+	if h, _ := c.History("a"); len(h) != 1 || h[0].Who != "frew" {
+		t.Errorf("expected history to be saved on close, got %+v", h)
+	}
+}
+
+// TestLegacySnapshot loads a snapshot from when History.When was a string in
+// the format of SQLite's CURRENT_TIMESTAMP.
+func TestLegacySnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	if err := os.WriteFile(path, []byte(`{"History": {"a": [{"From": "a", "To": "https://a.com", "When": "2019-04-01 12:30:00", "Who": "frew"}]}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h, _ := c.History("a"); len(h) != 1 || !h[0].When.Equal(time.Date(2019, 4, 1, 12, 30, 0, 0, time.UTC)) || h[0].Who != "frew" {
+		t.Errorf("expected history from the old snapshot, got %+v", h)
+	}
+}
+
+// TestTagsAliasing makes sure changing Tags after writing or reading them
+// doesn't change what is stored.
+func TestTagsAliasing(t *testing.T) {
+	c := New()
+
+	tags := []string{"a", "b"}
+	c.CreateShortlink(shortlinks.Shortlink{From: "x", To: "https://x.com", Tags: tags})
+	c.InsertHistory(shortlinks.History{From: "x", To: "https://x.com", Tags: tags})
+	tags[0] = "written"
+
+	sl, _ := c.Shortlink("x")
+	sl.Tags[1] = "read"
+	all, _ := c.AllShortlinks()
+	all[0].Tags[1] = "read"
+	h, _ := c.History("x")
+	h[0].Tags[1] = "read"
+
+	sl, _ = c.Shortlink("x")
+	h, _ = c.History("x")
+	if !slices.Equal(sl.Tags, []string{"a", "b"}) || !slices.Equal(h[0].Tags, []string{"a", "b"}) {
+		t.Errorf("expected stored tags to be unchanged, got %q and %q", sl.Tags, h[0].Tags)
+	}
+}
+
+func TestConcurrent(t *testing.T) {
+	c := New()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				c.InsertHistory(shortlinks.History{From: "a", To: "https://a.com"})
+				c.CreateShortlink(shortlinks.Shortlink{From: "a", To: "https://a.com"})
+				c.AllShortlinks()
+				c.History("a")
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if h, _ := c.History("a"); len(h) != 1000 {
+		t.Errorf("expected 1000 history entries, got %d", len(h))
+	}
+}
@@ -0,0 +1,4 @@
+CREATE TABLE dh_migrations (
+        "id" SERIAL PRIMARY KEY,
+        "version" VARCHAR(255)
+);
@@ -0,0 +1,30 @@
+CREATE TABLE shortlinks (
+        "from" TEXT PRIMARY KEY,
+        "to" TEXT NOT NULL,
+        "description" TEXT NOT NULL DEFAULT '',
+        "deleted" TIMESTAMPTZ
+);
+
+CREATE INDEX shortlinks_deleted ON shortlinks ("deleted") WHERE "deleted" IS NOT NULL;
+
+CREATE TABLE history (
+        "id" BIGSERIAL PRIMARY KEY,
+        "from" TEXT NOT NULL,
+        "to" TEXT NOT NULL,
+        "when" TIMESTAMPTZ NOT NULL DEFAULT now(),
+        "who" TEXT NOT NULL DEFAULT '',
+        "description" TEXT NOT NULL DEFAULT '',
+        "method" TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX history_from ON history ("from", "when");
+
+CREATE TABLE tokens (
+        "id" TEXT PRIMARY KEY,
+        "name" TEXT NOT NULL,
+        "owner" TEXT NOT NULL DEFAULT '',
+        "hash" TEXT NOT NULL UNIQUE,
+        "scopes" TEXT[] NOT NULL,
+        "created" TIMESTAMPTZ NOT NULL,
+        "expires" TIMESTAMPTZ
+);
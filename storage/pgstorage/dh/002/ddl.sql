@@ -0,0 +1,2 @@
+ALTER TABLE shortlinks ADD COLUMN "tags" TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE history ADD COLUMN "tags" TEXT[] NOT NULL DEFAULT '{}';
@@ -0,0 +1,10 @@
+ALTER TABLE shortlinks ADD COLUMN "created_at" TIMESTAMPTZ;
+ALTER TABLE shortlinks ADD COLUMN "created_by" TEXT NOT NULL DEFAULT '';
+ALTER TABLE shortlinks ADD COLUMN "updated_at" TIMESTAMPTZ;
+ALTER TABLE shortlinks ADD COLUMN "updated_by" TEXT NOT NULL DEFAULT '';
+
+UPDATE shortlinks s SET
+        "created_at" = (SELECT "when" FROM history h WHERE h."from" = s."from" ORDER BY h."id" LIMIT 1),
+        "created_by" = COALESCE((SELECT "who" FROM history h WHERE h."from" = s."from" ORDER BY h."id" LIMIT 1), ''),
+        "updated_at" = (SELECT "when" FROM history h WHERE h."from" = s."from" ORDER BY h."id" DESC LIMIT 1),
+        "updated_by" = COALESCE((SELECT "who" FROM history h WHERE h."from" = s."from" ORDER BY h."id" DESC LIMIT 1), '');
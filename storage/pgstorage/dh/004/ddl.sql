@@ -0,0 +1,6 @@
+-- Redirects to each shortlink, as a measure of popularity.  Kept apart from
+-- shortlinks so that counting doesn't touch them.
+CREATE TABLE hits (
+        "from" TEXT PRIMARY KEY,
+        "hits" BIGINT NOT NULL
+);
@@ -0,0 +1,159 @@
+package pgstorage
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/frioux/shortlinks/shortlinks"
+	"github.com/frioux/shortlinks/storage/storagetest"
+)
+
+// connect connects to the database in SHORTLINKS_PG_DSN after dropping
+// everything pgstorage creates, so run it against a scratch database, eg:
+//
+//	SHORTLINKS_PG_DSN='postgres://postgres@localhost/shortlinks_test?sslmode=disable' go test ./storage/pgstorage
+func connect(t *testing.T) *Client {
+	dsn := os.Getenv("SHORTLINKS_PG_DSN")
+	if dsn == "" {
+		t.Skip("SHORTLINKS_PG_DSN not set")
+	}
+
+	db, err := sqlx.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`DROP TABLE IF EXISTS shortlinks, history, tokens, dh_migrations`); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	c, err := Connect(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.db.Close() })
+
+	// Connecting again should be a noop.
+	if _, err := Connect(dsn); err != nil {
+		t.Fatal(err)
+	}
+
+	return c
+}
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) shortlinks.DB { return connect(t) })
+}
+
+func TestShortlinks(t *testing.T) {
+	c := connect(t)
+
+	if err := c.CreateShortlink(shortlinks.Shortlink{From: "b", To: "https://b.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.CreateShortlink(shortlinks.Shortlink{From: "a", To: "https://a.com", Description: "A"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.CreateShortlink(shortlinks.Shortlink{From: "a", To: "https://a.org", Description: "A!"}); err != nil {
+		t.Fatal(err)
+	}
+
+	sl, err := c.Shortlink("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sl.Equal(shortlinks.Shortlink{From: "a", To: "https://a.org", Description: "A!"}) {
+		t.Errorf("unexpected shortlink: %+v", sl)
+	}
+
+	sl, err = c.Shortlink("missing")
+	if err != nil || !sl.Equal(shortlinks.Shortlink{}) {
+		t.Errorf("expected zero shortlink and no error, got %+v (%v)", sl, err)
+	}
+
+	all, err := c.AllShortlinks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 2 || all[0].From != "a" || all[1].From != "b" {
+		t.Errorf("unexpected shortlinks: %+v", all)
+	}
+
+	if err := c.DeleteShortlink("b", "frew", "test"); err != nil {
+		t.Fatal(err)
+	}
+	if sl, _ := c.Shortlink("b"); sl.From != "" {
+		t.Errorf("expected b to be deleted, got %+v", sl)
+	}
+	del, err := c.DeletedShortlinks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(del) != 1 || del[0].From != "b" {
+		t.Errorf("unexpected deleted shortlinks: %+v", del)
+	}
+
+	if err := c.CreateShortlink(shortlinks.Shortlink{From: "b", To: "https://b.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if del, _ := c.DeletedShortlinks(); len(del) != 0 {
+		t.Errorf("expected b to be restored, got %+v", del)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	c := connect(t)
+
+	if err := c.CreateShortlink(shortlinks.Shortlink{From: "a", To: "https://2.com"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, to := range []string{"https://1.com", "https://2.com"} {
+		if err := c.InsertHistory(shortlinks.History{From: "a", To: to, Who: "frew", Method: "test"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.DeleteShortlink("a", "alice", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := c.History("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(h) != 3 {
+		t.Fatalf("expected 3 history entries, got %+v", h)
+	}
+	if h[0].To != "https://1.com" || h[1].To != "https://2.com" || h[2].To != "https://2.com" || h[2].Description != shortlinks.DeletedDescription || h[2].Who != "alice" {
+		t.Errorf("unexpected history: %+v", h)
+	}
+	if h[0].When.Location() != time.UTC || time.Since(h[0].When) > time.Minute {
+		t.Errorf("unexpected when: %s", h[0].When)
+	}
+}
+
+func TestTokens(t *testing.T) {
+	c := connect(t)
+
+	_, tok := shortlinks.NewToken("ci", "frew", []string{shortlinks.ScopeWrite}, time.Hour)
+	if err := c.CreateToken(tok); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := c.TokenByHash(tok.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != tok.ID || !got.Expires.Equal(tok.Expires) || !got.HasScope(shortlinks.ScopeWrite) {
+		t.Errorf("unexpected token: %+v", got)
+	}
+
+	if err := c.RevokeToken(tok.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := c.TokenByHash(tok.Hash); got.ID != "" {
+		t.Errorf("expected token to be revoked, got %+v", got)
+	}
+}
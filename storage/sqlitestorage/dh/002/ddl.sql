@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS tokens (
+        "id",
+        "name",
+        "owner",
+        "hash",
+        "scopes",
+        "created",
+        "expires",
+        PRIMARY KEY ("id")
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS tokens_hash ON tokens ("hash");
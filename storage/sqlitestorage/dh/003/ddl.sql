@@ -0,0 +1 @@
+ALTER TABLE history ADD COLUMN "method" DEFAULT '';
@@ -0,0 +1,2 @@
+ALTER TABLE shortlinks ADD COLUMN "tags" DEFAULT '';
+ALTER TABLE history ADD COLUMN "tags" DEFAULT '';
@@ -0,0 +1,10 @@
+ALTER TABLE shortlinks ADD COLUMN "created_at" DEFAULT '';
+ALTER TABLE shortlinks ADD COLUMN "created_by" DEFAULT '';
+ALTER TABLE shortlinks ADD COLUMN "updated_at" DEFAULT '';
+ALTER TABLE shortlinks ADD COLUMN "updated_by" DEFAULT '';
+
+UPDATE shortlinks SET
+        "created_at" = COALESCE((SELECT strftime('%Y-%m-%dT%H:%M:%SZ', "when") FROM history h WHERE h."from" = shortlinks."from" ORDER BY h.rowid LIMIT 1), ''),
+        "created_by" = COALESCE((SELECT "who" FROM history h WHERE h."from" = shortlinks."from" ORDER BY h.rowid LIMIT 1), ''),
+        "updated_at" = COALESCE((SELECT strftime('%Y-%m-%dT%H:%M:%SZ', "when") FROM history h WHERE h."from" = shortlinks."from" ORDER BY h.rowid DESC LIMIT 1), ''),
+        "updated_by" = COALESCE((SELECT "who" FROM history h WHERE h."from" = shortlinks."from" ORDER BY h.rowid DESC LIMIT 1), '');
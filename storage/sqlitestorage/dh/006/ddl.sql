@@ -0,0 +1,106 @@
+-- Rebuild every table with types, so that SQLite checks what's stored, and
+-- indexes for what the driver looks up.  Times stay TEXT in the format of
+-- CURRENT_TIMESTAMP, except created_at and updated_at, which are RFC3339.
+
+-- Rows without a key, or whose keys are the same once cast to TEXT (untyped,
+-- 1 and '1' were different keys), can't be carried over, so rather than
+-- silently dropping them the migration fails, naming what to fix.
+CREATE TEMP TABLE migration_006_check (
+        "null" INTEGER CONSTRAINT "shortlinks, history or tokens with a NULL from, id or hash must be fixed or deleted first" CHECK ("null" = 0),
+        "dupes" INTEGER CONSTRAINT "shortlinks or tokens with the same from, id or hash once cast to TEXT must be merged or deleted first" CHECK ("dupes" = 0)
+);
+INSERT INTO migration_006_check VALUES (
+        (SELECT count(*) FROM shortlinks WHERE "from" IS NULL) +
+        (SELECT count(*) FROM history WHERE "from" IS NULL) +
+        (SELECT count(*) FROM tokens WHERE "id" IS NULL OR "hash" IS NULL),
+        (SELECT count(*) FROM (SELECT 1 FROM shortlinks GROUP BY CAST("from" AS TEXT) HAVING count(*) > 1)) +
+        (SELECT count(*) FROM (SELECT 1 FROM tokens GROUP BY CAST("id" AS TEXT) HAVING count(*) > 1)) +
+        (SELECT count(*) FROM (SELECT 1 FROM tokens GROUP BY CAST("hash" AS TEXT) HAVING count(*) > 1))
+);
+DROP TABLE migration_006_check;
+
+CREATE TABLE shortlinks_new (
+        "from" TEXT NOT NULL PRIMARY KEY,
+        "to" TEXT NOT NULL,
+        "description" TEXT NOT NULL DEFAULT '',
+        "tags" TEXT NOT NULL DEFAULT '',
+        "deleted" TEXT,
+        "created_at" TEXT NOT NULL DEFAULT '',
+        "created_by" TEXT NOT NULL DEFAULT '',
+        "updated_at" TEXT NOT NULL DEFAULT '',
+        "updated_by" TEXT NOT NULL DEFAULT ''
+) STRICT;
+
+INSERT INTO shortlinks_new
+SELECT
+        CAST("from" AS TEXT),
+        CAST(COALESCE("to", '') AS TEXT),
+        CAST(COALESCE("description", '') AS TEXT),
+        CAST(COALESCE("tags", '') AS TEXT),
+        CAST("deleted" AS TEXT),
+        CAST(COALESCE("created_at", '') AS TEXT),
+        CAST(COALESCE("created_by", '') AS TEXT),
+        CAST(COALESCE("updated_at", '') AS TEXT),
+        CAST(COALESCE("updated_by", '') AS TEXT)
+FROM shortlinks;
+
+DROP TABLE shortlinks;
+ALTER TABLE shortlinks_new RENAME TO shortlinks;
+
+CREATE INDEX shortlinks_live ON shortlinks ("from") WHERE "deleted" IS NULL;
+CREATE INDEX shortlinks_deleted ON shortlinks ("from") WHERE "deleted" IS NOT NULL;
+
+-- History was ordered by rowid, which "id" keeps.
+CREATE TABLE history_new (
+        "id" INTEGER PRIMARY KEY,
+        "from" TEXT NOT NULL,
+        "to" TEXT NOT NULL,
+        "when" TEXT NOT NULL,
+        "who" TEXT NOT NULL DEFAULT '',
+        "description" TEXT NOT NULL DEFAULT '',
+        "method" TEXT NOT NULL DEFAULT '',
+        "tags" TEXT NOT NULL DEFAULT ''
+) STRICT;
+
+INSERT INTO history_new
+SELECT
+        rowid,
+        CAST("from" AS TEXT),
+        CAST(COALESCE("to", '') AS TEXT),
+        CAST(COALESCE(strftime('%Y-%m-%d %H:%M:%S', "when"), "when", CURRENT_TIMESTAMP) AS TEXT),
+        CAST(COALESCE("who", '') AS TEXT),
+        CAST(COALESCE("description", '') AS TEXT),
+        CAST(COALESCE("method", '') AS TEXT),
+        CAST(COALESCE("tags", '') AS TEXT)
+FROM history;
+
+DROP TABLE history;
+ALTER TABLE history_new RENAME TO history;
+
+CREATE INDEX history_from ON history ("from", "id");
+
+CREATE TABLE tokens_new (
+        "id" TEXT NOT NULL PRIMARY KEY,
+        "name" TEXT NOT NULL,
+        "owner" TEXT NOT NULL DEFAULT '',
+        "hash" TEXT NOT NULL,
+        "scopes" TEXT NOT NULL DEFAULT '',
+        "created" INTEGER NOT NULL,
+        "expires" INTEGER NOT NULL DEFAULT 0
+) STRICT;
+
+INSERT INTO tokens_new
+SELECT
+        CAST("id" AS TEXT),
+        CAST(COALESCE("name", '') AS TEXT),
+        CAST(COALESCE("owner", '') AS TEXT),
+        CAST("hash" AS TEXT),
+        CAST(COALESCE("scopes", '') AS TEXT),
+        CAST(COALESCE("created", 0) AS INTEGER),
+        CAST(COALESCE("expires", 0) AS INTEGER)
+FROM tokens;
+
+DROP TABLE tokens;
+ALTER TABLE tokens_new RENAME TO tokens;
+
+CREATE UNIQUE INDEX tokens_hash ON tokens ("hash");
@@ -0,0 +1,20 @@
+-- Store every time in shortlinks.WhenFormat: UTC RFC3339 with nanoseconds,
+-- which sort as strings.  History and deletion times were in the format of
+-- CURRENT_TIMESTAMP, and created_at and updated_at RFC3339 with as few
+-- fractional digits as needed.
+
+UPDATE history SET "when" = strftime('%Y-%m-%dT%H:%M:%S', "when") || '.000000000Z'
+WHERE strftime('%Y-%m-%dT%H:%M:%S', "when") IS NOT NULL;
+
+UPDATE shortlinks SET "deleted" = strftime('%Y-%m-%dT%H:%M:%S', "deleted") || '.000000000Z'
+WHERE strftime('%Y-%m-%dT%H:%M:%S', "deleted") IS NOT NULL;
+
+UPDATE shortlinks SET "created_at" =
+        substr("created_at", 1, 19) || '.' ||
+        substr(CASE WHEN instr("created_at", '.') = 0 THEN '' ELSE substr("created_at", 21, length("created_at") - 21) END || '000000000', 1, 9) || 'Z'
+WHERE "created_at" != '';
+
+UPDATE shortlinks SET "updated_at" =
+        substr("updated_at", 1, 19) || '.' ||
+        substr(CASE WHEN instr("updated_at", '.') = 0 THEN '' ELSE substr("updated_at", 21, length("updated_at") - 21) END || '000000000', 1, 9) || 'Z'
+WHERE "updated_at" != '';
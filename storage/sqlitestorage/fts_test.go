@@ -0,0 +1,20 @@
+//go:build sqlite_fts5
+
+package sqlitestorage
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// TestFTS makes sure the full text index is used when built for it, so that
+// the search conformance tests run against it.
+func TestFTS(t *testing.T) {
+	c, err := Connect("file:" + filepath.Join(t.TempDir(), "db.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.fts {
+		t.Error("expected shortlinks_fts with -tags sqlite_fts5")
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"embed"
 	"fmt"
 	"io/fs"
+	"strings"
+	"time"
 
 	"github.com/frioux/dh"
 	"github.com/jmoiron/sqlx"
@@ -40,34 +42,176 @@ func Connect(dsn string) (*Client, error) {
 
 	fss, _ := fs.Sub(dhFS, "dh")
 	if err := e.MigrateAll(db, fss); err != nil {
+		if strings.Contains(err.Error(), "once cast to TEXT") {
+			if keys, kerr := castCollisions(db); kerr == nil {
+				err = fmt.Errorf("%w: %s", err, strings.Join(keys, ", "))
+			}
+		}
 		return nil, fmt.Errorf("dh.Migrator.MigrateAll: %w", err)
 	}
 
-	return &Client{db: db}, nil
+	fts, err := setupFTS(db)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{db: db, fts: fts}, nil
+}
+
+// castCollisions lists the shortlinks and tokens that migration 006 refuses
+// to carry over because their keys are the same once cast to TEXT, so that
+// the error says which rows to fix.
+func castCollisions(db *sqlx.DB) ([]string, error) {
+	var keys []string
+	err := db.Select(&keys, `
+		SELECT 'shortlink ' || CAST("from" AS TEXT) FROM shortlinks GROUP BY CAST("from" AS TEXT) HAVING count(*) > 1
+		UNION ALL
+		SELECT 'token ' || CAST("id" AS TEXT) FROM tokens GROUP BY CAST("id" AS TEXT) HAVING count(*) > 1
+		UNION ALL
+		SELECT 'tokens ' || group_concat(CAST("id" AS TEXT), ' and ') || ' (same hash)' FROM tokens GROUP BY CAST("hash" AS TEXT) HAVING count(*) > 1`)
+	return keys, err
+}
+
+// setupFTS creates and fills a full text index of shortlinks, kept up to date
+// with triggers, if SQLite has FTS5 (with go-sqlite3, build with
+// -tags sqlite_fts5).  It returns false if it doesn't.
+//
+// The index is recreated every time, which is cheap at the scale of
+// shortlinks and means it never has to be migrated.
+func setupFTS(db *sqlx.DB) (bool, error) {
+	for _, sql := range []string{
+		`DROP TRIGGER IF EXISTS shortlinks_fts_insert`,
+		`DROP TRIGGER IF EXISTS shortlinks_fts_delete`,
+		`DROP TRIGGER IF EXISTS shortlinks_fts_update`,
+		`DROP TABLE IF EXISTS shortlinks_fts`,
+	} {
+		if _, err := db.Exec(sql); err != nil && !strings.Contains(err.Error(), "no such module") {
+			return false, fmt.Errorf("couldn't drop shortlinks_fts: %w", err)
+		}
+	}
+
+	_, err := db.Exec(`CREATE VIRTUAL TABLE shortlinks_fts USING fts5("from", "to", "description", "tags", content='shortlinks', content_rowid='rowid')`)
+	if err != nil && strings.Contains(err.Error(), "no such module") {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("couldn't create shortlinks_fts: %w", err)
+	}
+
+	for _, sql := range []string{
+		`CREATE TRIGGER shortlinks_fts_insert AFTER INSERT ON shortlinks BEGIN
+			INSERT INTO shortlinks_fts(rowid, "from", "to", "description", "tags") VALUES (new.rowid, new."from", new."to", new."description", new."tags");
+		END`,
+		`CREATE TRIGGER shortlinks_fts_delete AFTER DELETE ON shortlinks BEGIN
+			INSERT INTO shortlinks_fts(shortlinks_fts, rowid, "from", "to", "description", "tags") VALUES ('delete', old.rowid, old."from", old."to", old."description", old."tags");
+		END`,
+		`CREATE TRIGGER shortlinks_fts_update AFTER UPDATE ON shortlinks BEGIN
+			INSERT INTO shortlinks_fts(shortlinks_fts, rowid, "from", "to", "description", "tags") VALUES ('delete', old.rowid, old."from", old."to", old."description", old."tags");
+			INSERT INTO shortlinks_fts(rowid, "from", "to", "description", "tags") VALUES (new.rowid, new."from", new."to", new."description", new."tags");
+		END`,
+		`INSERT INTO shortlinks_fts(shortlinks_fts) VALUES ('rebuild')`,
+	} {
+		if _, err := db.Exec(sql); err != nil {
+			return false, fmt.Errorf("couldn't set up shortlinks_fts: %w", err)
+		}
+	}
+
+	return true, nil
 }
 
 type Client struct {
 	db *sqlx.DB
+
+	// fts is true if shortlinks_fts is available; see setupFTS.
+	fts bool
+}
+
+// shortlink is how shortlinks.Shortlink is stored; tags are space separated
+// and times are in shortlinks.WhenFormat, with an empty string meaning unset.
+type shortlink struct {
+	From        string `db:"from"`
+	To          string `db:"to"`
+	Description string `db:"description"`
+	Tags        string `db:"tags"`
+	CreatedAt   string `db:"created_at"`
+	CreatedBy   string `db:"created_by"`
+	UpdatedAt   string `db:"updated_at"`
+	UpdatedBy   string `db:"updated_by"`
+}
+
+func (s shortlink) shortlink() shortlinks.Shortlink {
+	return shortlinks.Shortlink{
+		From:        s.From,
+		To:          s.To,
+		Description: s.Description,
+		Tags:        tags(s.Tags),
+
+		CreatedAt: parseTime(s.CreatedAt),
+		CreatedBy: s.CreatedBy,
+		UpdatedAt: parseTime(s.UpdatedAt),
+		UpdatedBy: s.UpdatedBy,
+	}
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return shortlinks.FormatWhen(t)
+}
+
+// parseTime parses a time stored by formatTime, or in an older format the
+// migrations couldn't convert.  Anything unparseable is the zero time, so
+// that one bad row doesn't make a shortlink's history unreadable.
+func parseTime(s string) time.Time {
+	t, _ := shortlinks.ParseWhen(s)
+	return t
+}
+
+func tags(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Fields(s)
+}
+
+func (c Client) selectShortlinks(query string, args ...interface{}) ([]shortlinks.Shortlink, error) {
+	sls := []shortlink{}
+	if err := c.db.Select(&sls, query, args...); err != nil {
+		return nil, err
+	}
+	ret := make([]shortlinks.Shortlink, len(sls))
+	for i, sl := range sls {
+		ret[i] = sl.shortlink()
+	}
+	return ret, nil
 }
 
 func (c Client) Shortlink(from string) (shortlinks.Shortlink, error) {
-	ret := shortlinks.Shortlink{}
-	err := c.db.Get(&ret, `SELECT "from", "to", "description" FROM shortlinks WHERE "from" = ? AND "deleted" IS NULL`, from)
+	var sl shortlink
+	err := c.db.Get(&sl, `SELECT "from", "to", "description", "tags", "created_at", "created_by", "updated_at", "updated_by" FROM shortlinks WHERE "from" = ? AND "deleted" IS NULL`, from)
 
 	if err != nil && err != sql.ErrNoRows {
-		return ret, fmt.Errorf("couldn't load shortlink (%s): %w", from, err)
+		return shortlinks.Shortlink{}, fmt.Errorf("couldn't load shortlink (%s): %w", from, err)
 	}
 
-	return ret, nil
+	return sl.shortlink(), nil
 }
 
 func (c Client) CreateShortlink(s shortlinks.Shortlink) error {
-	_, err := c.db.Exec(`INSERT INTO shortlinks("from", "to", "description") VALUES (?, ?, ?)
+	// Restoring a deleted shortlink creates it again.
+	_, err := c.db.Exec(`INSERT INTO shortlinks("from", "to", "description", "tags", "created_at", "created_by", "updated_at", "updated_by") VALUES (?, ?, ?, ?, ?, ?, ?, ?)
 			  ON CONFLICT("from") DO
 			  UPDATE SET
 			  "to"          = "excluded"."to",
 			  "deleted"     = null,
-			  "description" = "excluded"."description"`, s.From, s.To, s.Description)
+			  "description" = "excluded"."description",
+			  "tags"        = "excluded"."tags",
+			  "created_at"  = CASE WHEN "deleted" IS NULL THEN "created_at" ELSE "excluded"."created_at" END,
+			  "created_by"  = CASE WHEN "deleted" IS NULL THEN "created_by" ELSE "excluded"."created_by" END,
+			  "updated_at"  = "excluded"."updated_at",
+			  "updated_by"  = "excluded"."updated_by"`,
+		s.From, s.To, s.Description, strings.Join(s.Tags, " "), formatTime(s.CreatedAt), s.CreatedBy, formatTime(s.UpdatedAt), s.UpdatedBy)
 
 	if err != nil {
 		return fmt.Errorf("couldn't insert shortlink (%s): %w", s.From, err)
@@ -75,12 +219,20 @@ func (c Client) CreateShortlink(s shortlinks.Shortlink) error {
 	return nil
 }
 
-func (c Client) DeleteShortlink(from, who string) error {
-	if err := c.InsertHistory(shortlinks.History{From: from, To: "«deleted»", Who: who}); err != nil {
+func (c Client) DeleteShortlink(from, who, method string) error {
+	sl, err := c.Shortlink(from)
+	if err != nil {
+		return err
+	}
+	if sl.From == "" {
+		return nil
+	}
+
+	if err := c.InsertHistory(shortlinks.History{From: from, To: sl.To, Who: who, Method: method, Description: shortlinks.DeletedDescription, Tags: sl.Tags}); err != nil {
 		return fmt.Errorf("couldn't insert delete history for shortlink (%s): %w", from, err)
 	}
 
-	_, err := c.db.Exec(`UPDATE shortlinks SET "deleted"=CURRENT_TIMESTAMP WHERE "from" = ?`, from)
+	_, err = c.db.Exec(`UPDATE shortlinks SET "deleted" = ? WHERE "from" = ?`, shortlinks.FormatWhen(time.Now()), from)
 
 	if err != nil {
 		return fmt.Errorf("couldn't delete shortlink (%s): %w", from, err)
@@ -89,36 +241,237 @@ func (c Client) DeleteShortlink(from, who string) error {
 }
 
 func (c Client) AllShortlinks() ([]shortlinks.Shortlink, error) {
-	ret := []shortlinks.Shortlink{}
-	err := c.db.Select(&ret, `SELECT "to", "from", "description" FROM shortlinks WHERE "deleted" IS NULL ORDER BY "from"`)
+	ret, err := c.selectShortlinks(`SELECT "to", "from", "description", "tags", "created_at", "created_by", "updated_at", "updated_by" FROM shortlinks WHERE "deleted" IS NULL ORDER BY "from"`)
 	if err != nil {
 		return nil, fmt.Errorf("couldn't load shortlinks: %w", err)
 	}
 	return ret, nil
 }
 
+func (c Client) ShortlinksPage(after string, limit int) ([]shortlinks.Shortlink, string, error) {
+	ret, err := c.selectShortlinks(`SELECT "to", "from", "description", "tags", "created_at", "created_by", "updated_at", "updated_by" FROM shortlinks WHERE "deleted" IS NULL AND "from" > ? ORDER BY "from" LIMIT ?`, after, limit+1)
+	if err != nil {
+		return nil, "", fmt.Errorf("couldn't load shortlinks: %w", err)
+	}
+	ret, next := shortlinks.Page(ret, limit)
+	return ret, next, nil
+}
+
+func (c Client) ShortlinksPageByAuthor(author, after string, limit int) ([]shortlinks.Shortlink, string, error) {
+	ret, err := c.selectShortlinks(`SELECT "to", "from", "description", "tags", "created_at", "created_by", "updated_at", "updated_by" FROM shortlinks WHERE "deleted" IS NULL AND ("created_by" = ? OR "updated_by" = ?) AND "from" > ? ORDER BY "from" LIMIT ?`, author, author, after, limit+1)
+	if err != nil {
+		return nil, "", fmt.Errorf("couldn't load shortlinks: %w", err)
+	}
+	ret, next := shortlinks.Page(ret, limit)
+	return ret, next, nil
+}
+
 func (c Client) DeletedShortlinks() ([]shortlinks.Shortlink, error) {
-	ret := []shortlinks.Shortlink{}
-	err := c.db.Select(&ret, `SELECT "to", "from", "description" FROM shortlinks WHERE "deleted" IS NOT NULL ORDER BY "from"`)
+	ret, err := c.selectShortlinks(`SELECT "to", "from", "description", "tags", "created_at", "created_by", "updated_at", "updated_by" FROM shortlinks WHERE "deleted" IS NOT NULL ORDER BY "from"`)
 	if err != nil {
 		return nil, fmt.Errorf("couldn't load shortlinks: %w", err)
 	}
 	return ret, nil
 }
 
+// SearchShortlinks uses the full text index if there is one, otherwise it
+// returns every shortlink for shortlinks.Search to rank.
+func (c Client) SearchShortlinks(terms []string) ([]shortlinks.Shortlink, error) {
+	if !c.fts {
+		return c.AllShortlinks()
+	}
+
+	// Terms are only letters and digits, so quoting them is enough.
+	match := make([]string, len(terms))
+	for i, t := range terms {
+		match[i] = `"` + t + `"*`
+	}
+
+	ret, err := c.selectShortlinks(`SELECT s."to", s."from", s."description", s."tags", s."created_at", s."created_by", s."updated_at", s."updated_by" FROM shortlinks_fts f JOIN shortlinks s ON s.rowid = f.rowid
+			  WHERE shortlinks_fts MATCH ? AND s."deleted" IS NULL`, strings.Join(match, " OR "))
+	if err != nil {
+		return nil, fmt.Errorf("couldn't search shortlinks: %w", err)
+	}
+	return ret, nil
+}
+
+// history is how shortlinks.History is stored; tags are space separated and
+// "when" is in shortlinks.WhenFormat.
+type history struct {
+	From        string `db:"from"`
+	To          string `db:"to"`
+	When        string `db:"when"`
+	Who         string `db:"who"`
+	Description string `db:"description"`
+	Method      string `db:"method"`
+	Tags        string `db:"tags"`
+}
+
 func (c Client) History(from string) ([]shortlinks.History, error) {
-	ret := []shortlinks.History{}
-	err := c.db.Select(&ret, `SELECT "to", "from", "when", "who", "description" FROM history WHERE "from" = ?`, from)
+	hs := []history{}
+	err := c.db.Select(&hs, `SELECT "to", "from", "when", "who", "description", "method", "tags" FROM history WHERE "from" = ? ORDER BY "id"`, from)
 	if err != nil {
 		return nil, fmt.Errorf("couldn't load history (for %s): %w", from, err)
 	}
+	ret := make([]shortlinks.History, len(hs))
+	for i, h := range hs {
+		ret[i] = shortlinks.History{
+			From:        h.From,
+			To:          h.To,
+			When:        parseTime(h.When),
+			Who:         h.Who,
+			Description: h.Description,
+			Method:      h.Method,
+			Tags:        tags(h.Tags),
+		}
+	}
 	return ret, nil
 }
 
 func (c Client) InsertHistory(h shortlinks.History) error {
-	_, err := c.db.Exec(`INSERT INTO history("from", "to", "when", "who", "description") VALUES (?, ?, CURRENT_TIMESTAMP, ?, ?)`, h.From, h.To, h.Who, h.Description)
+	_, err := c.db.Exec(`INSERT INTO history("from", "to", "when", "who", "description", "method", "tags") VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		h.From, h.To, shortlinks.FormatWhen(time.Now()), h.Who, h.Description, h.Method, strings.Join(h.Tags, " "))
 	if err != nil {
 		return fmt.Errorf("couldn't insert history (%s): %w", h.From, err)
 	}
 	return nil
 }
+
+func (c Client) LoadShortlink(sl shortlinks.Shortlink, deleted bool) error {
+	_, err := c.db.Exec(`INSERT INTO shortlinks("from", "to", "description", "tags", "created_at", "created_by", "updated_at", "updated_by", "deleted") VALUES (?, ?, ?, ?, ?, ?, ?, ?, CASE WHEN ? THEN ? END)
+			  ON CONFLICT("from") DO
+			  UPDATE SET
+			  "to"          = "excluded"."to",
+			  "deleted"     = "excluded"."deleted",
+			  "description" = "excluded"."description",
+			  "tags"        = "excluded"."tags",
+			  "created_at"  = "excluded"."created_at",
+			  "created_by"  = "excluded"."created_by",
+			  "updated_at"  = "excluded"."updated_at",
+			  "updated_by"  = "excluded"."updated_by"`,
+		sl.From, sl.To, sl.Description, strings.Join(sl.Tags, " "), formatTime(sl.CreatedAt), sl.CreatedBy, formatTime(sl.UpdatedAt), sl.UpdatedBy, deleted, shortlinks.FormatWhen(time.Now()))
+
+	if err != nil {
+		return fmt.Errorf("couldn't load shortlink (%s): %w", sl.From, err)
+	}
+	return nil
+}
+
+func (c Client) LoadHistory(h shortlinks.History) error {
+	_, err := c.db.Exec(`INSERT INTO history("from", "to", "when", "who", "description", "method", "tags") VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		h.From, h.To, shortlinks.FormatWhen(h.When), h.Who, h.Description, h.Method, strings.Join(h.Tags, " "))
+	if err != nil {
+		return fmt.Errorf("couldn't load history (%s): %w", h.From, err)
+	}
+	return nil
+}
+
+// token is how shortlinks.Token is stored; scopes are space separated and
+// times are unix seconds, with 0 meaning unset.
+type token struct {
+	ID      string `db:"id"`
+	Name    string `db:"name"`
+	Owner   string `db:"owner"`
+	Hash    string `db:"hash"`
+	Scopes  string `db:"scopes"`
+	Created int64  `db:"created"`
+	Expires int64  `db:"expires"`
+}
+
+func (t token) token() shortlinks.Token {
+	ret := shortlinks.Token{
+		ID:      t.ID,
+		Name:    t.Name,
+		Owner:   t.Owner,
+		Hash:    t.Hash,
+		Scopes:  strings.Fields(t.Scopes),
+		Created: time.Unix(t.Created, 0).UTC(),
+	}
+	if t.Expires != 0 {
+		ret.Expires = time.Unix(t.Expires, 0).UTC()
+	}
+	return ret
+}
+
+func (c Client) CreateToken(t shortlinks.Token) error {
+	var expires int64
+	if !t.Expires.IsZero() {
+		expires = t.Expires.Unix()
+	}
+	_, err := c.db.Exec(`INSERT INTO tokens("id", "name", "owner", "hash", "scopes", "created", "expires") VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		t.ID, t.Name, t.Owner, t.Hash, strings.Join(t.Scopes, " "), t.Created.Unix(), expires)
+	if err != nil {
+		return fmt.Errorf("couldn't insert token (%s): %w", t.Name, err)
+	}
+	return nil
+}
+
+func (c Client) TokenByHash(hash string) (shortlinks.Token, error) {
+	var t token
+	err := c.db.Get(&t, `SELECT "id", "name", "owner", "hash", "scopes", "created", "expires" FROM tokens WHERE "hash" = ?`, hash)
+	if err == sql.ErrNoRows {
+		return shortlinks.Token{}, nil
+	}
+	if err != nil {
+		return shortlinks.Token{}, fmt.Errorf("couldn't load token: %w", err)
+	}
+	return t.token(), nil
+}
+
+func (c Client) Tokens() ([]shortlinks.Token, error) {
+	ts := []token{}
+	err := c.db.Select(&ts, `SELECT "id", "name", "owner", "hash", "scopes", "created", "expires" FROM tokens ORDER BY "created"`)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't load tokens: %w", err)
+	}
+	ret := make([]shortlinks.Token, len(ts))
+	for i, t := range ts {
+		ret[i] = t.token()
+	}
+	return ret, nil
+}
+
+func (c Client) RevokeToken(id string) error {
+	_, err := c.db.Exec(`DELETE FROM tokens WHERE "id" = ?`, id)
+	if err != nil {
+		return fmt.Errorf("couldn't revoke token (%s): %w", id, err)
+	}
+	return nil
+}
+
+func (c Client) AddHits(from string, n int) error {
+	_, err := c.db.Exec(`INSERT INTO hits ("from", "hits") VALUES (?, ?)
+		ON CONFLICT ("from") DO UPDATE SET "hits" = "hits" + "excluded"."hits"`, from, n)
+	if err != nil {
+		return fmt.Errorf("couldn't count hits (%s): %w", from, err)
+	}
+	return nil
+}
+
+func (c Client) Hits() (map[string]int, error) {
+	var rows []struct {
+		From string `db:"from"`
+		Hits int    `db:"hits"`
+	}
+	if err := c.db.Select(&rows, `SELECT "from", "hits" FROM hits`); err != nil {
+		return nil, fmt.Errorf("couldn't load hits: %w", err)
+	}
+	ret := make(map[string]int, len(rows))
+	for _, r := range rows {
+		ret[r.From] = r.Hits
+	}
+	return ret, nil
+}
+
+func (c Client) ShortlinksPageByHits(offset, limit int) ([]shortlinks.Shortlink, bool, error) {
+	ret, err := c.selectShortlinks(`SELECT s."to", s."from", s."description", s."tags", s."created_at", s."created_by", s."updated_at", s."updated_by"
+		FROM shortlinks s LEFT JOIN hits h ON h."from" = s."from"
+		WHERE s."deleted" IS NULL ORDER BY COALESCE(h."hits", 0) DESC, s."from" LIMIT ? OFFSET ?`, limit+1, offset)
+	if err != nil {
+		return nil, false, fmt.Errorf("couldn't load shortlinks: %w", err)
+	}
+	if len(ret) > limit {
+		return ret[:limit], true, nil
+	}
+	return ret, false, nil
+}
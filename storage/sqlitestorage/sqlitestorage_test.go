@@ -0,0 +1,275 @@
+package sqlitestorage
+
+import (
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/frioux/dh"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/frioux/shortlinks/shortlinks"
+	"github.com/frioux/shortlinks/storage/storagetest"
+)
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) shortlinks.DB {
+		c, err := Connect("file:" + filepath.Join(t.TempDir(), "db.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { c.db.Close() })
+		return c
+	})
+}
+
+// fixture creates a database migrated up to and including version, runs sqls
+// in it and returns its DSN, for testing upgrades.
+func fixture(t *testing.T, version string, sqls ...string) string {
+	t.Helper()
+
+	dsn := "file:" + filepath.Join(t.TempDir(), "db.db")
+	db, err := sqlx.Open("sqlite3", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	e := dh.NewMigrator()
+	if err := e.MigrateOne(db, dh.DHMigrations, "000-sqlite"); err != nil {
+		t.Fatal(err)
+	}
+	fss, _ := fs.Sub(dhFS, "dh")
+	plan, err := fs.ReadFile(fss, "plan.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range strings.Fields(string(plan))[1:] {
+		if err := e.MigrateOne(db, fss, v); err != nil {
+			t.Fatal(err)
+		}
+		if v == version {
+			break
+		}
+	}
+
+	for _, sql := range sqls {
+		if _, err := db.Exec(sql); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dsn
+}
+
+// TestBackfillTimestamps upgrades a database from before shortlinks had
+// timestamps and authors, which are filled in from history.
+func TestBackfillTimestamps(t *testing.T) {
+	dsn := fixture(t, "004",
+		`INSERT INTO shortlinks ("from", "to", "description") VALUES ('a', 'https://a.com', ''), ('b', 'https://b.com', '')`,
+		`INSERT INTO history ("from", "to", "when", "who", "description") VALUES
+			('a', 'https://a.org', '2024-01-02 03:04:05', 'frew', ''),
+			('a', 'https://a.com', '2024-02-03 04:05:06', 'alice', '')`,
+	)
+
+	c, err := Connect(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.db.Close()
+
+	a, err := c.Shortlink("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC); !a.CreatedAt.Equal(want) || a.CreatedBy != "frew" {
+		t.Errorf("expected a created at %s by frew, got %+v", want, a)
+	}
+	if want := time.Date(2024, 2, 3, 4, 5, 6, 0, time.UTC); !a.UpdatedAt.Equal(want) || a.UpdatedBy != "alice" {
+		t.Errorf("expected a updated at %s by alice, got %+v", want, a)
+	}
+
+	if b, _ := c.Shortlink("b"); !b.CreatedAt.IsZero() || !b.UpdatedAt.IsZero() || b.CreatedBy != "" {
+		t.Errorf("expected b without history to have no timestamps, got %+v", b)
+	}
+}
+
+// TestTypedSchema upgrades a database from before the tables were STRICT,
+// with the sort of loosely typed data that SQLite used to allow.
+func TestTypedSchema(t *testing.T) {
+	dsn := fixture(t, "005",
+		`INSERT INTO shortlinks ("from", "to", "description", "tags", "deleted") VALUES
+			('a', 'https://a.com', NULL, 'docs eng', NULL),
+			(1, 'https://1.com', 'one', '', NULL),
+			('gone', 'https://gone.com', 'Gone', '', '2024-01-01 00:00:00')`,
+		`INSERT INTO history ("from", "to", "when", "who", "description", "method", "tags") VALUES
+			('a', 'https://a.org', '2024-01-02 03:04:05', 'frew', '', '', ''),
+			('a', 'https://a.com', '2024-02-03 04:05:06', NULL, NULL, NULL, NULL)`,
+		`INSERT INTO tokens ("id", "name", "owner", "hash", "scopes", "created", "expires") VALUES
+			('t1', 'ci', 'frew', 'h1', 'read write', '1700000000', NULL)`,
+	)
+
+	c, err := Connect(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.db.Close()
+
+	if a, _ := c.Shortlink("a"); a.To != "https://a.com" || a.Description != "" || len(a.Tags) != 2 {
+		t.Errorf("expected a to be converted, got %+v", a)
+	}
+	if one, _ := c.Shortlink("1"); one.To != "https://1.com" {
+		t.Errorf("expected numeric from to become text, got %+v", one)
+	}
+	if del, _ := c.DeletedShortlinks(); len(del) != 1 || del[0].From != "gone" {
+		t.Errorf("expected gone to still be deleted, got %+v", del)
+	}
+
+	h, err := c.History("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(h) != 2 || h[0].To != "https://a.org" || h[1].Who != "" || !h[1].When.Equal(time.Date(2024, 2, 3, 4, 5, 6, 0, time.UTC)) {
+		t.Errorf("expected history to be converted in order, got %+v", h)
+	}
+
+	tok, err := c.TokenByHash("h1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.ID != "t1" || tok.Created.Unix() != 1700000000 || !tok.Expires.IsZero() {
+		t.Errorf("expected token to be converted, got %+v", tok)
+	}
+
+	// Writing the wrong type is now an error rather than silently stored.
+	if _, err := c.db.Exec(`INSERT INTO tokens ("id", "name", "hash", "created") VALUES ('t2', 'x', 'h2', 'yesterday')`); err == nil {
+		t.Error("expected tokens to be STRICT")
+	}
+
+	for _, test := range []struct{ query, index string }{
+		{`SELECT * FROM history WHERE "from" = 'a' ORDER BY "id"`, "history_from"},
+		{`SELECT * FROM shortlinks WHERE "deleted" IS NULL ORDER BY "from"`, "shortlinks_live"},
+		{`SELECT * FROM shortlinks WHERE "deleted" IS NOT NULL ORDER BY "from"`, "shortlinks_deleted"},
+	} {
+		var plan []struct {
+			ID      int    `db:"id"`
+			Parent  int    `db:"parent"`
+			NotUsed int    `db:"notused"`
+			Detail  string `db:"detail"`
+		}
+		if err := c.db.Select(&plan, "EXPLAIN QUERY PLAN "+test.query); err != nil {
+			t.Fatal(err)
+		}
+		if len(plan) == 0 || !strings.Contains(plan[0].Detail, test.index) {
+			t.Errorf("expected %s to use %s, got %+v", test.query, test.index, plan)
+		}
+	}
+}
+
+// TestTypedSchemaNullKeys makes sure rows that can't be carried over to the
+// typed schema fail the upgrade instead of disappearing.
+func TestTypedSchemaNullKeys(t *testing.T) {
+	for _, sql := range []string{
+		`INSERT INTO shortlinks ("from", "to") VALUES (NULL, 'https://a.com')`,
+		`INSERT INTO history ("from", "to", "when") VALUES (NULL, 'https://a.com', '2024-01-02 03:04:05')`,
+		`INSERT INTO tokens ("id", "name", "hash", "created") VALUES ('t1', 'ci', NULL, 1700000000)`,
+	} {
+		dsn := fixture(t, "005", sql)
+
+		c, err := Connect(dsn)
+		if err == nil {
+			c.db.Close()
+			t.Errorf("expected upgrade to fail after %s", sql)
+			continue
+		}
+		if !strings.Contains(err.Error(), "must be fixed or deleted first") {
+			t.Errorf("expected upgrade to say what's wrong, got %s", err)
+		}
+	}
+}
+
+// TestTypedSchemaCollisions makes sure rows whose keys were only distinct
+// because they had different types fail the upgrade, naming them, instead of
+// one of them disappearing.
+func TestTypedSchemaCollisions(t *testing.T) {
+	for _, test := range []struct{ sql, named string }{
+		{`INSERT INTO shortlinks ("from", "to", "deleted") VALUES
+			(1, 'https://1.com', NULL),
+			('1', 'https://one.com', '2024-01-01 00:00:00')`, "shortlink 1"},
+		{`INSERT INTO tokens ("id", "name", "hash", "created") VALUES
+			(2, 'ci', 'h1', 1700000000),
+			('2', 'cd', 'h2', 1700000000)`, "token 2"},
+		{`INSERT INTO tokens ("id", "name", "hash", "created") VALUES
+			('t1', 'ci', 3, 1700000000),
+			('t2', 'cd', '3', 1700000000)`, "tokens t1 and t2 (same hash)"},
+	} {
+		dsn := fixture(t, "005", test.sql)
+
+		c, err := Connect(dsn)
+		if err == nil {
+			c.db.Close()
+			t.Errorf("expected upgrade to fail after %s", test.sql)
+			continue
+		}
+		if !strings.Contains(err.Error(), "must be merged or deleted first") || !strings.Contains(err.Error(), test.named) {
+			t.Errorf("expected upgrade to name %s, got %s", test.named, err)
+		}
+	}
+}
+
+// TestTimeFormat upgrades a database from before every time was stored in
+// shortlinks.WhenFormat.
+func TestTimeFormat(t *testing.T) {
+	dsn := fixture(t, "006",
+		`INSERT INTO shortlinks ("from", "to", "deleted", "created_at", "updated_at") VALUES
+			('a', 'https://a.com', NULL, '2024-01-02T03:04:05Z', '2024-02-03T04:05:06.5Z'),
+			('b', 'https://b.com', '2024-03-04 05:06:07', '', '')`,
+		`INSERT INTO history ("from", "to", "when") VALUES
+			('a', 'https://a.org', '2024-01-02 03:04:05'),
+			('a', 'https://a.com', '2024-02-03 04:05:06'),
+			('b', 'https://b.com', 'last tuesday')`,
+	)
+
+	c, err := Connect(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.db.Close()
+
+	var got []string
+	if err := c.db.Select(&got, `SELECT "when" FROM history UNION ALL SELECT "deleted" FROM shortlinks WHERE "deleted" IS NOT NULL
+		UNION ALL SELECT "created_at" FROM shortlinks UNION ALL SELECT "updated_at" FROM shortlinks`); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"2024-01-02T03:04:05.000000000Z",
+		"2024-02-03T04:05:06.000000000Z",
+		"last tuesday",
+		"2024-03-04T05:06:07.000000000Z",
+		"2024-01-02T03:04:05.000000000Z",
+		"",
+		"2024-02-03T04:05:06.500000000Z",
+		"",
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("expected times to be converted to %v, got %v", want, got)
+	}
+
+	h, err := c.History("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(h) != 2 || !h[0].When.Equal(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Errorf("expected history to load, got %+v", h)
+	}
+	if a, _ := c.Shortlink("a"); !a.UpdatedAt.Equal(time.Date(2024, 2, 3, 4, 5, 6, 500000000, time.UTC)) {
+		t.Errorf("expected updated_at to keep its fraction, got %+v", a)
+	}
+
+	// A time that couldn't be converted doesn't stop the rest loading.
+	if h, err := c.History("b"); err != nil || len(h) != 1 || h[0].To != "https://b.com" || !h[0].When.IsZero() {
+		t.Errorf("expected history with an unknown time, got %+v (%v)", h, err)
+	}
+}
@@ -0,0 +1,547 @@
+// Package storagetest verifies that a storage driver implements the shortlinks.DB contract.
+package storagetest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/frioux/shortlinks/shortlinks"
+)
+
+// Run runs the conformance tests as subtests of t.
+func Run(t *testing.T, open func(t *testing.T) shortlinks.DB) {
+	for _, test := range []struct {
+		name string
+		fn   func(*testing.T, shortlinks.DB)
+	}{
+		{"CreateAndUpdate", testCreateAndUpdate},
+		{"NotFound", testNotFound},
+		{"Delete", testDelete},
+		{"Restore", testRestore},
+		{"History", testHistory},
+		{"Tokens", testTokens},
+		{"Load", testLoad},
+		{"Search", testSearch},
+		{"Tags", testTags},
+		{"Paging", testPaging},
+		{"AuthorPaging", testAuthorPaging},
+		{"Timestamps", testTimestamps},
+		{"Hits", testHits},
+		{"PopularPaging", testPopularPaging},
+	} {
+		t.Run(test.name, func(t *testing.T) { test.fn(t, open(t)) })
+	}
+}
+
+func must(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func froms(sls []shortlinks.Shortlink) []string {
+	ret := make([]string, len(sls))
+	for i, sl := range sls {
+		ret[i] = sl.From
+	}
+	return ret
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func testCreateAndUpdate(t *testing.T, db shortlinks.DB) {
+	must(t, db.CreateShortlink(shortlinks.Shortlink{From: "b", To: "https://b.com"}))
+	must(t, db.CreateShortlink(shortlinks.Shortlink{From: "c", To: "https://c.com/%s"}))
+	must(t, db.CreateShortlink(shortlinks.Shortlink{From: "a", To: "https://a.com", Description: "A"}))
+	must(t, db.CreateShortlink(shortlinks.Shortlink{From: "a", To: "https://a.org", Description: "A!"}))
+
+	sl, err := db.Shortlink("a")
+	must(t, err)
+	if !sl.Equal(shortlinks.Shortlink{From: "a", To: "https://a.org", Description: "A!"}) {
+		t.Errorf("expected update to replace a, got %+v", sl)
+	}
+
+	// Updating with an empty description clears it.
+	must(t, db.CreateShortlink(shortlinks.Shortlink{From: "a", To: "https://a.org"}))
+	if sl, _ := db.Shortlink("a"); sl.Description != "" {
+		t.Errorf("expected description to be cleared, got %+v", sl)
+	}
+
+	all, err := db.AllShortlinks()
+	must(t, err)
+	if got := froms(all); !equal(got, []string{"a", "b", "c"}) {
+		t.Errorf("expected all shortlinks ordered by from, got %v", got)
+	}
+	if all[2].To != "https://c.com/%s" {
+		t.Errorf("expected placeholder to be stored verbatim, got %+v", all[2])
+	}
+}
+
+func testNotFound(t *testing.T, db shortlinks.DB) {
+	sl, err := db.Shortlink("missing")
+	if err != nil || !sl.Equal(shortlinks.Shortlink{}) {
+		t.Errorf("expected zero shortlink and no error, got %+v (%v)", sl, err)
+	}
+
+	h, err := db.History("missing")
+	if err != nil || len(h) != 0 {
+		t.Errorf("expected no history and no error, got %+v (%v)", h, err)
+	}
+
+	if err := db.DeleteShortlink("missing", "frew", "test"); err != nil {
+		t.Errorf("expected deleting a missing shortlink to not be an error, got %v", err)
+	}
+
+	all, err := db.AllShortlinks()
+	if err != nil || len(all) != 0 {
+		t.Errorf("expected no shortlinks, got %+v (%v)", all, err)
+	}
+}
+
+func testDelete(t *testing.T, db shortlinks.DB) {
+	must(t, db.CreateShortlink(shortlinks.Shortlink{From: "a", To: "https://a.com"}))
+	must(t, db.CreateShortlink(shortlinks.Shortlink{From: "b", To: "https://b.com", Description: "B"}))
+	must(t, db.DeleteShortlink("b", "frew", "test"))
+
+	if sl, _ := db.Shortlink("b"); sl.From != "" {
+		t.Errorf("expected b to be deleted, got %+v", sl)
+	}
+	all, err := db.AllShortlinks()
+	must(t, err)
+	if got := froms(all); !equal(got, []string{"a"}) {
+		t.Errorf("expected only a to remain, got %v", got)
+	}
+
+	h, err := db.History("b")
+	must(t, err)
+	if len(h) != 1 {
+		t.Fatalf("expected delete to record history, got %+v", h)
+	}
+	if h[0].From != "b" || h[0].To != "https://b.com" || h[0].Description != shortlinks.DeletedDescription ||
+		h[0].Who != "frew" || h[0].Method != "test" {
+		t.Errorf("unexpected delete history: %+v", h[0])
+	}
+
+	dbd, ok := db.(shortlinks.DBDeleted)
+	if !ok {
+		return
+	}
+	del, err := dbd.DeletedShortlinks()
+	must(t, err)
+	if len(del) != 1 || !del[0].Equal(shortlinks.Shortlink{From: "b", To: "https://b.com", Description: "B"}) {
+		t.Errorf("unexpected deleted shortlinks: %+v", del)
+	}
+}
+
+func testRestore(t *testing.T, db shortlinks.DB) {
+	must(t, db.CreateShortlink(shortlinks.Shortlink{From: "a", To: "https://a.com"}))
+	must(t, db.DeleteShortlink("a", "frew", "test"))
+	must(t, db.CreateShortlink(shortlinks.Shortlink{From: "a", To: "https://a.org"}))
+
+	if sl, _ := db.Shortlink("a"); sl.To != "https://a.org" {
+		t.Errorf("expected a to be restored, got %+v", sl)
+	}
+	if all, _ := db.AllShortlinks(); !equal(froms(all), []string{"a"}) {
+		t.Errorf("expected a to be listed once, got %+v", all)
+	}
+
+	dbd, ok := db.(shortlinks.DBDeleted)
+	if !ok {
+		return
+	}
+	if del, _ := dbd.DeletedShortlinks(); len(del) != 0 {
+		t.Errorf("expected a to no longer be deleted, got %+v", del)
+	}
+}
+
+func testHistory(t *testing.T, db shortlinks.DB) {
+	for _, to := range []string{"https://1.com", "https://2.com", "https://3.com"} {
+		must(t, db.CreateShortlink(shortlinks.Shortlink{From: "a", To: to}))
+		must(t, db.InsertHistory(shortlinks.History{From: "a", To: to, Who: "frew", Method: "test", Description: "desc"}))
+	}
+	must(t, db.InsertHistory(shortlinks.History{From: "b", To: "https://b.com", Who: "frew"}))
+	must(t, db.DeleteShortlink("a", "alice", ""))
+
+	h, err := db.History("a")
+	must(t, err)
+	if len(h) != 4 {
+		t.Fatalf("expected 4 history entries, got %+v", h)
+	}
+	done := time.Now()
+
+	// History is oldest first.
+	for i, to := range []string{"https://1.com", "https://2.com", "https://3.com", "https://3.com"} {
+		if h[i].To != to {
+			t.Errorf("expected history %d to be %s, got %+v", i, to, h[i])
+		}
+		if h[i].From != "a" {
+			t.Errorf("expected history %d to be for a, got %+v", i, h[i])
+		}
+		if h[i].When.IsZero() || h[i].When.After(done) || h[i].When.Before(done.Add(-time.Minute)) {
+			t.Errorf("expected history %d to record when, got %+v", i, h[i])
+		}
+		if i > 0 && h[i].When.Before(h[i-1].When) {
+			t.Errorf("expected history %d to be after %s, got %+v", i, h[i-1].When, h[i])
+		}
+	}
+	if h[0].Who != "frew" || h[0].Method != "test" || h[0].Description != "desc" {
+		t.Errorf("unexpected history: %+v", h[0])
+	}
+	if h[3].Who != "alice" || h[3].Method != "" || h[3].Description != shortlinks.DeletedDescription {
+		t.Errorf("unexpected delete history: %+v", h[3])
+	}
+}
+
+func testTokens(t *testing.T, db shortlinks.DB) {
+	dbt, ok := db.(shortlinks.DBTokens)
+	if !ok {
+		t.Skip("driver does not support tokens")
+	}
+
+	_, a := shortlinks.NewToken("a", "frew", []string{shortlinks.ScopeWrite}, time.Hour)
+	_, b := shortlinks.NewToken("b", "frew", []string{shortlinks.ScopeRead, shortlinks.ScopeAdmin}, 0)
+	must(t, dbt.CreateToken(a))
+	must(t, dbt.CreateToken(b))
+
+	got, err := dbt.TokenByHash(a.Hash)
+	must(t, err)
+	if got.ID != a.ID || got.Name != "a" || got.Owner != "frew" || !got.Expires.Equal(a.Expires) ||
+		!got.Created.Equal(a.Created) || !got.HasScope(shortlinks.ScopeWrite) || got.HasScope(shortlinks.ScopeAdmin) {
+		t.Errorf("unexpected token: %+v", got)
+	}
+	if got, _ := dbt.TokenByHash(b.Hash); !got.Expires.IsZero() || !got.HasScope(shortlinks.ScopeAdmin) {
+		t.Errorf("unexpected token: %+v", got)
+	}
+	if got, err := dbt.TokenByHash("missing"); err != nil || got.ID != "" {
+		t.Errorf("expected zero token and no error, got %+v (%v)", got, err)
+	}
+
+	ts, err := dbt.Tokens()
+	must(t, err)
+	if len(ts) != 2 || ts[0].ID == ts[1].ID {
+		t.Errorf("expected both tokens, got %+v", ts)
+	}
+
+	must(t, dbt.RevokeToken(a.ID))
+	if got, _ := dbt.TokenByHash(a.Hash); got.ID != "" {
+		t.Errorf("expected token to be revoked, got %+v", got)
+	}
+	if ts, _ := dbt.Tokens(); len(ts) != 1 {
+		t.Errorf("expected one token left, got %+v", ts)
+	}
+}
+
+func testLoad(t *testing.T, db shortlinks.DB) {
+	l, ok := db.(shortlinks.DBLoader)
+	if !ok {
+		t.Skip("driver does not support loading")
+	}
+
+	must(t, l.LoadShortlink(shortlinks.Shortlink{From: "a", To: "https://a.com", Description: "A"}, false))
+	must(t, l.LoadShortlink(shortlinks.Shortlink{From: "b", To: "https://b.com"}, true))
+
+	// Times are kept to at least the microsecond.
+	when := time.Date(2019, 4, 1, 12, 30, 0, 123456000, time.UTC)
+	must(t, l.LoadHistory(shortlinks.History{From: "a", To: "https://a.org", When: when, Who: "frew", Method: "test"}))
+	must(t, l.LoadHistory(shortlinks.History{From: "a", To: "https://a.com", When: when.Add(time.Hour), Who: "alice"}))
+
+	if sl, _ := db.Shortlink("a"); !sl.Equal(shortlinks.Shortlink{From: "a", To: "https://a.com", Description: "A"}) {
+		t.Errorf("unexpected shortlink: %+v", sl)
+	}
+	if sl, _ := db.Shortlink("b"); sl.From != "" {
+		t.Errorf("expected b to be loaded as deleted, got %+v", sl)
+	}
+	if dbd, ok := db.(shortlinks.DBDeleted); ok {
+		if del, _ := dbd.DeletedShortlinks(); len(del) != 1 || del[0].From != "b" {
+			t.Errorf("unexpected deleted shortlinks: %+v", del)
+		}
+	}
+
+	h, err := db.History("a")
+	must(t, err)
+	if len(h) != 2 {
+		t.Fatalf("expected 2 history entries, got %+v", h)
+	}
+	for i, want := range []time.Time{when, when.Add(time.Hour)} {
+		if !h[i].When.Equal(want) {
+			t.Errorf("expected history %d to be from %s, got %s", i, want, h[i].When)
+		}
+	}
+	if h[0].Who != "frew" || h[0].Method != "test" || h[1].Who != "alice" {
+		t.Errorf("unexpected history: %+v", h)
+	}
+}
+
+// testSearch goes through shortlinks.Search, so that drivers that are a
+// shortlinks.DBSearch are checked against the in memory search.
+func testSearch(t *testing.T, db shortlinks.DB) {
+	must(t, db.CreateShortlink(shortlinks.Shortlink{From: "docs", To: "https://docs.example.com", Description: "Team handbook", Tags: []string{"onboarding"}}))
+	must(t, db.CreateShortlink(shortlinks.Shortlink{From: "ci", To: "https://ci.example.com/builds", Description: "Build status"}))
+	must(t, db.CreateShortlink(shortlinks.Shortlink{From: "gone", To: "https://handbook.example.com"}))
+	must(t, db.DeleteShortlink("gone", "frew", "test"))
+	must(t, db.CreateShortlink(shortlinks.Shortlink{From: "wiki", To: "https://wiki.example.com"}))
+	must(t, db.CreateShortlink(shortlinks.Shortlink{From: "wiki", To: "https://wiki.example.com", Description: "Handbook drafts"}))
+
+	for _, test := range []struct {
+		q    string
+		want []string
+	}{
+		{"docs", []string{"docs"}},
+		{"hand", []string{"docs", "wiki"}},
+		{"BUILD", []string{"ci"}},
+		{"example", []string{"ci", "docs", "wiki"}},
+		{"team handbook", []string{"docs"}},
+		{"wikki", []string{"wiki"}},
+		{"onboard", []string{"docs"}},
+		{"nothing", []string{}},
+	} {
+		rs, err := shortlinks.Search(db, test.q, 10)
+		must(t, err)
+		got := []string{}
+		for _, r := range rs {
+			got = append(got, r.From)
+		}
+		if !equal(got, test.want) {
+			t.Errorf("expected search for %q to find %v, got %v", test.q, test.want, got)
+		}
+	}
+}
+
+func testTags(t *testing.T, db shortlinks.DB) {
+	a := shortlinks.Shortlink{From: "a", To: "https://a.com", Tags: []string{"docs", "eng"}}
+	must(t, db.CreateShortlink(a))
+	must(t, db.InsertHistory(shortlinks.History{From: "a", To: "https://a.com", Who: "frew", Tags: []string{"docs", "eng"}}))
+	must(t, db.CreateShortlink(shortlinks.Shortlink{From: "b", To: "https://b.com"}))
+
+	if sl, _ := db.Shortlink("a"); !sl.Equal(a) {
+		t.Errorf("expected tags to be stored, got %+v", sl)
+	}
+	if sl, _ := db.Shortlink("b"); len(sl.Tags) != 0 {
+		t.Errorf("expected no tags, got %+v", sl)
+	}
+	if all, _ := db.AllShortlinks(); len(all) != 2 || !all[0].Equal(a) {
+		t.Errorf("expected tags in all shortlinks, got %+v", all)
+	}
+
+	// Updating replaces the tags.
+	must(t, db.CreateShortlink(shortlinks.Shortlink{From: "a", To: "https://a.com", Tags: []string{"ops"}}))
+	if sl, _ := db.Shortlink("a"); !equal(sl.Tags, []string{"ops"}) {
+		t.Errorf("expected tags to be replaced, got %+v", sl)
+	}
+	must(t, db.CreateShortlink(shortlinks.Shortlink{From: "a", To: "https://a.com"}))
+	if sl, _ := db.Shortlink("a"); len(sl.Tags) != 0 {
+		t.Errorf("expected tags to be cleared, got %+v", sl)
+	}
+
+	h, err := db.History("a")
+	must(t, err)
+	if len(h) != 1 || !equal(h[0].Tags, []string{"docs", "eng"}) {
+		t.Errorf("expected tags in history, got %+v", h)
+	}
+
+	must(t, db.CreateShortlink(shortlinks.Shortlink{From: "a", To: "https://a.com", Tags: []string{"ops"}}))
+	must(t, db.DeleteShortlink("a", "frew", "test"))
+	h, err = db.History("a")
+	must(t, err)
+	if len(h) != 2 || !equal(h[1].Tags, []string{"ops"}) {
+		t.Errorf("expected delete history to record the tags, got %+v", h)
+	}
+	if dbd, ok := db.(shortlinks.DBDeleted); ok {
+		if del, _ := dbd.DeletedShortlinks(); len(del) != 1 || !equal(del[0].Tags, []string{"ops"}) {
+			t.Errorf("expected deleted shortlink to keep its tags, got %+v", del)
+		}
+	}
+
+	if l, ok := db.(shortlinks.DBLoader); ok {
+		c := shortlinks.Shortlink{From: "c", To: "https://c.com", Tags: []string{"x"}}
+		must(t, l.LoadShortlink(c, false))
+		must(t, l.LoadHistory(shortlinks.History{From: "c", To: "https://c.com", When: time.Date(2019, 4, 1, 12, 30, 0, 0, time.UTC), Tags: []string{"x"}}))
+		if sl, _ := db.Shortlink("c"); !sl.Equal(c) {
+			t.Errorf("expected loaded tags, got %+v", sl)
+		}
+		if h, _ := db.History("c"); len(h) != 1 || !equal(h[0].Tags, []string{"x"}) {
+			t.Errorf("expected loaded history tags, got %+v", h)
+		}
+	}
+}
+
+func testPaging(t *testing.T, db shortlinks.DB) {
+	p, ok := shortlinks.As[shortlinks.DBPager](db)
+	if !ok {
+		t.Skip("not a shortlinks.DBPager")
+	}
+
+	for _, from := range []string{"e", "b", "d", "a", "c", "f"} {
+		must(t, db.CreateShortlink(shortlinks.Shortlink{From: from, To: "https://" + from + ".com"}))
+	}
+	must(t, db.DeleteShortlink("c", "frew", "test"))
+
+	// Drivers may return an empty last page, so keep going until there's
+	// no next page.
+	var got []string
+	var pages int
+	for after := ""; ; {
+		sls, next, err := p.ShortlinksPage(after, 2)
+		must(t, err)
+		if len(sls) > 2 {
+			t.Fatalf("expected at most 2 shortlinks per page, got %v", froms(sls))
+		}
+		got = append(got, froms(sls)...)
+		if pages++; next == "" || pages > 5 {
+			break
+		}
+		after = next
+	}
+	if want := []string{"a", "b", "d", "e", "f"}; !equal(got, want) {
+		t.Errorf("expected pages to have %v, got %v", want, got)
+	}
+
+	if sls, next, err := p.ShortlinksPage("b", 10); err != nil || next != "" || !equal(froms(sls), []string{"d", "e", "f"}) {
+		t.Errorf("expected the rest after b, got %v, %q, %v", froms(sls), next, err)
+	}
+}
+
+func testAuthorPaging(t *testing.T, db shortlinks.DB) {
+	p, ok := shortlinks.As[shortlinks.DBAuthorPager](db)
+	if !ok {
+		t.Skip("not a shortlinks.DBAuthorPager")
+	}
+
+	for _, sl := range []struct{ from, created, updated string }{
+		{"a", "frew", "frew"},
+		{"b", "alice", "alice"},
+		{"c", "alice", "frew"},
+		{"d", "frew", "alice"},
+		{"e", "frew", "frew"},
+	} {
+		must(t, db.CreateShortlink(shortlinks.Shortlink{From: sl.from, To: "https://" + sl.from + ".com", CreatedBy: sl.created, UpdatedBy: sl.updated}))
+	}
+	must(t, db.DeleteShortlink("e", "frew", "test"))
+
+	var got []string
+	var pages int
+	for after := ""; ; {
+		sls, next, err := p.ShortlinksPageByAuthor("frew", after, 2)
+		must(t, err)
+		if len(sls) > 2 {
+			t.Fatalf("expected at most 2 shortlinks per page, got %v", froms(sls))
+		}
+		got = append(got, froms(sls)...)
+		if pages++; next == "" || pages > 5 {
+			break
+		}
+		after = next
+	}
+	if want := []string{"a", "c", "d"}; !equal(got, want) {
+		t.Errorf("expected pages to have %v, got %v", want, got)
+	}
+
+	if sls, next, err := p.ShortlinksPageByAuthor("alice", "b", 10); err != nil || next != "" || !equal(froms(sls), []string{"c", "d"}) {
+		t.Errorf("expected alice's after b, got %v, %q, %v", froms(sls), next, err)
+	}
+}
+
+func testTimestamps(t *testing.T, db shortlinks.DB) {
+	t1 := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	t2 := t1.Add(time.Hour)
+	t3 := t2.Add(time.Hour)
+	check := func(from string, createdAt time.Time, createdBy string, updatedAt time.Time, updatedBy string) {
+		t.Helper()
+		sl, err := db.Shortlink(from)
+		must(t, err)
+		if !sl.CreatedAt.Equal(createdAt) || sl.CreatedBy != createdBy || !sl.UpdatedAt.Equal(updatedAt) || sl.UpdatedBy != updatedBy {
+			t.Errorf("expected %s created %s by %q and updated %s by %q, got %+v", from, createdAt, createdBy, updatedAt, updatedBy, sl)
+		}
+	}
+
+	must(t, db.CreateShortlink(shortlinks.Shortlink{From: "a", To: "https://a.com", CreatedAt: t1, CreatedBy: "frew", UpdatedAt: t1, UpdatedBy: "frew"}))
+	check("a", t1, "frew", t1, "frew")
+
+	// Updates keep when and by whom the shortlink was created.
+	must(t, db.CreateShortlink(shortlinks.Shortlink{From: "a", To: "https://a.org", CreatedAt: t2, CreatedBy: "alice", UpdatedAt: t2, UpdatedBy: "alice"}))
+	check("a", t1, "frew", t2, "alice")
+	if all, _ := db.AllShortlinks(); len(all) != 1 || !all[0].CreatedAt.Equal(t1) || !all[0].UpdatedAt.Equal(t2) {
+		t.Errorf("expected timestamps in all shortlinks, got %+v", all)
+	}
+
+	// Restoring a deleted shortlink creates it again.
+	must(t, db.DeleteShortlink("a", "frew", "test"))
+	must(t, db.CreateShortlink(shortlinks.Shortlink{From: "a", To: "https://a.net", CreatedAt: t3, CreatedBy: "bob", UpdatedAt: t3, UpdatedBy: "bob"}))
+	check("a", t3, "bob", t3, "bob")
+
+	must(t, db.CreateShortlink(shortlinks.Shortlink{From: "b", To: "https://b.com"}))
+	check("b", time.Time{}, "", time.Time{}, "")
+
+	if l, ok := db.(shortlinks.DBLoader); ok {
+		must(t, l.LoadShortlink(shortlinks.Shortlink{From: "a", To: "https://a.com", CreatedAt: t1, CreatedBy: "frew", UpdatedAt: t2, UpdatedBy: "alice"}, false))
+		check("a", t1, "frew", t2, "alice")
+	}
+}
+
+func testHits(t *testing.T, db shortlinks.DB) {
+	h, ok := shortlinks.As[shortlinks.DBHits](db)
+	if !ok {
+		t.Skip("not a shortlinks.DBHits")
+	}
+
+	if hits, err := h.Hits(); err != nil || len(hits) != 0 {
+		t.Errorf("expected no hits yet, got %v, %v", hits, err)
+	}
+
+	must(t, h.AddHits("a", 1))
+	must(t, h.AddHits("b", 1))
+	must(t, h.AddHits("a", 1))
+	must(t, h.AddHits("a", 3))
+
+	hits, err := h.Hits()
+	must(t, err)
+	if len(hits) != 2 || hits["a"] != 5 || hits["b"] != 1 {
+		t.Errorf("expected a to have 5 hits and b 1, got %v", hits)
+	}
+}
+
+func testPopularPaging(t *testing.T, db shortlinks.DB) {
+	p, ok := shortlinks.As[shortlinks.DBPopularPager](db)
+	if !ok {
+		t.Skip("not a shortlinks.DBPopularPager")
+	}
+	h, ok := shortlinks.As[shortlinks.DBHits](db)
+	if !ok {
+		t.Fatal("a shortlinks.DBPopularPager must also be a shortlinks.DBHits")
+	}
+
+	for _, from := range []string{"a", "b", "c", "d", "e"} {
+		must(t, db.CreateShortlink(shortlinks.Shortlink{From: from, To: "https://" + from + ".com"}))
+	}
+	must(t, h.AddHits("c", 3))
+	must(t, h.AddHits("e", 5))
+	must(t, h.AddHits("a", 3))
+	must(t, db.DeleteShortlink("e", "frew", "test"))
+
+	var got []string
+	for offset := 0; offset < 10; offset += 2 {
+		sls, more, err := p.ShortlinksPageByHits(offset, 2)
+		must(t, err)
+		if len(sls) > 2 {
+			t.Fatalf("expected at most 2 shortlinks per page, got %v", froms(sls))
+		}
+		got = append(got, froms(sls)...)
+		if !more {
+			break
+		}
+	}
+	if want := []string{"a", "c", "b", "d"}; !equal(got, want) {
+		t.Errorf("expected pages to have %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/frioux/shortlinks/declarative"
+	"github.com/frioux/shortlinks/shortlinks"
+)
+
+// syncCmd plans or applies declarative config; see declarative.Syncer.
+func syncCmd(args []string) error {
+	fs := flag.NewFlagSet("sync", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s sync [-db <db>] [-prune] [-pull] [-who <who>] [-deny-domains <domains>] plan|apply file\n\n", os.Args[0])
+		fs.PrintDefaults()
+		fmt.Fprintf(fs.Output(), "\n%s\n", dbSpecUsage)
+	}
+
+	var spec, who, denyDomains string
+	var prune, pull bool
+	fs.StringVar(&spec, "db", "sqlite:file:db.db", "database to sync into")
+	fs.StringVar(&who, "who", os.Getenv("USER"), "who to record the changes as made by if the file isn't in git")
+	fs.BoolVar(&prune, "prune", false, "delete links that were synced before but are no longer in the file")
+	fs.BoolVar(&pull, "pull", false, "git pull before applying")
+	fs.StringVar(&denyDomains, "deny-domains", "", "comma separated domains shortlinks may not point to")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 || (fs.Arg(0) != "plan" && fs.Arg(0) != "apply") {
+		fs.Usage()
+		return errors.New("plan or apply and a file are required")
+	}
+
+	db, err := openDB(spec)
+	if err != nil {
+		return err
+	}
+
+	s := &declarative.Syncer{DB: db, Path: fs.Arg(1), Prune: prune, Pull: pull, Who: who, Denied: shortlinks.ParseDomainList(denyDomains)}
+	if fs.Arg(0) == "plan" {
+		changes, err := s.Plan()
+		if err != nil {
+			return err
+		}
+		printChanges(changes)
+		return nil
+	}
+
+	changes, err := s.Apply()
+	printChanges(changes)
+	return err
+}